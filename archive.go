@@ -0,0 +1,346 @@
+// archive.go
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Formats d'archive acceptés comme destination, reconnus à l'extension de DEST_DIR
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// Méthode rapportée pour les fichiers écrits dans une archive
+const usedArchive = "archive"
+
+// Taille maximale d'un fichier lu en mémoire par le worker avant d'être transmis au
+// rédacteur de l'archive; au-delà, le rédacteur relit la source
+const archiveBufferLimit = 4 * 1024 * 1024
+
+// archiveFormat retourne le format d'archive correspondant au chemin, ou "" pour un répertoire
+func archiveFormat(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveTar
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	}
+	return ""
+}
+
+// archiveEntry est un fichier préparé par un worker et écrit par le rédacteur de l'archive
+type archiveEntry struct {
+	name   string
+	source string
+	info   os.FileInfo
+	link   string // cible d'un lien symbolique copié tel quel
+	data   []byte // contenu déjà lu pour les petits fichiers, nil sinon
+	digest string // empreinte calculée par le worker si la vérification est activée
+	done   chan error
+}
+
+// archiveWriter sérialise les entrées de l'archive: les workers lisent et hachent les
+// fichiers en parallèle, une seule goroutine écrit dans l'archive
+type archiveWriter struct {
+	path      string
+	format    string
+	algorithm string
+	limiter   *rateLimiter
+	file      *os.File
+	gz        *gzip.Writer
+	tw        *tar.Writer
+	zw        *zip.Writer
+	entries   chan archiveEntry
+	written   map[string]bool
+	wg        sync.WaitGroup
+	err       error // erreur ayant laissé une entrée incomplète, l'archive est inutilisable
+}
+
+// openArchive crée l'archive sous un nom temporaire et démarre son rédacteur
+func openArchive(path string, config *Config) (*archiveWriter, error) {
+	format := archiveFormat(path)
+	if format == "" {
+		return nil, fmt.Errorf("format d'archive non reconnu: %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("impossible de créer le répertoire de l'archive: %w", err)
+	}
+	file, err := os.Create(tempPathFor(path))
+	if err != nil {
+		return nil, fmt.Errorf("impossible de créer l'archive: %w", err)
+	}
+	a := &archiveWriter{
+		path:      path,
+		format:    format,
+		algorithm: config.HashAlgorithm,
+		limiter:   config.limiter,
+		file:      file,
+		entries:   make(chan archiveEntry),
+		written:   make(map[string]bool),
+	}
+	switch format {
+	case ArchiveTar:
+		a.tw = tar.NewWriter(file)
+	case ArchiveTarGz:
+		a.gz = gzip.NewWriter(file)
+		a.tw = tar.NewWriter(a.gz)
+	case ArchiveZip:
+		a.zw = zip.NewWriter(file)
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// run écrit les entrées une à une dans l'ordre de leur arrivée
+func (a *archiveWriter) run() {
+	defer a.wg.Done()
+	for entry := range a.entries {
+		entry.done <- a.write(entry)
+	}
+}
+
+// add transmet une entrée au rédacteur et attend qu'elle soit écrite
+func (a *archiveWriter) add(entry archiveEntry) error {
+	entry.done = make(chan error, 1)
+	a.entries <- entry
+	return <-entry.done
+}
+
+// write ajoute une entrée à l'archive. Une erreur avant l'en-tête peut être retentée;
+// une erreur après laisse une entrée incomplète et rend l'archive inutilisable.
+func (a *archiveWriter) write(entry archiveEntry) error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.written[entry.name] {
+		return fmt.Errorf("%w: %s figure déjà dans l'archive", ErrCopyIgnored, entry.name)
+	}
+
+	// Ouvrir la source avant l'en-tête pour qu'un échec reste sans effet sur l'archive
+	var body io.Reader = strings.NewReader(entry.link)
+	if entry.link == "" {
+		if entry.data != nil {
+			body = bytes.NewReader(entry.data)
+		} else {
+			sourceFile, err := os.Open(entry.source)
+			if err != nil {
+				return err
+			}
+			defer sourceFile.Close()
+			body = io.LimitReader(sourceFile, entry.info.Size())
+		}
+	}
+
+	w, err := a.header(entry)
+	if err != nil {
+		return a.fail(fmt.Errorf("impossible d'écrire l'en-tête de %s: %w", entry.name, err))
+	}
+	a.written[entry.name] = true
+
+	// Recalculer l'empreinte des octets écrits pour détecter une source modifiée entre
+	// la lecture par le worker et l'écriture
+	var hasher hash.Hash
+	if entry.digest != "" && entry.data == nil {
+		if hasher, err = newHasher(a.algorithm); err != nil {
+			return a.fail(err)
+		}
+		body = io.TeeReader(body, hasher)
+	}
+	if a.limiter != nil {
+		w = throttledWriter{w: w, limiter: a.limiter}
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return a.fail(fmt.Errorf("erreur lors de l'écriture de %s dans l'archive: %w", entry.name, err))
+	}
+	if entry.link == "" && n != entry.info.Size() {
+		return a.fail(fmt.Errorf("%s: %d octets écrits sur %d, la source a changé", entry.name, n, entry.info.Size()))
+	}
+	if hasher != nil {
+		if written := fmt.Sprintf("%x", hasher.Sum(nil)); written != entry.digest {
+			return a.fail(fmt.Errorf("%w: source %s, archive %s", ErrHashMismatch,
+				formatDigest(a.algorithm, entry.digest), formatDigest(a.algorithm, written)))
+		}
+	}
+	return nil
+}
+
+// header écrit l'en-tête de l'entrée avec son mode et sa date et retourne son flux
+func (a *archiveWriter) header(entry archiveEntry) (io.Writer, error) {
+	name := filepath.ToSlash(entry.name)
+	if a.zw != nil {
+		header, err := zip.FileInfoHeader(entry.info)
+		if err != nil {
+			return nil, err
+		}
+		header.Name = name
+		header.Modified = entry.info.ModTime()
+		if entry.link == "" {
+			header.Method = zip.Deflate
+		}
+		return a.zw.CreateHeader(header)
+	}
+	header, err := tar.FileInfoHeader(entry.info, entry.link)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	if err := a.tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return a.tw, nil
+}
+
+// fail mémorise l'erreur qui rend l'archive inutilisable, sans nouvelle tentative possible
+func (a *archiveWriter) fail(err error) error {
+	a.err = fmt.Errorf("%w: archive %s inutilisable: %v", ErrCopyRefused, a.path, err)
+	return a.err
+}
+
+// Close termine l'archive et la renomme sur son nom final. Avec abort, ou si une entrée
+// est restée incomplète, l'archive temporaire est supprimée.
+func (a *archiveWriter) Close(abort bool) error {
+	close(a.entries)
+	a.wg.Wait()
+	tempPath := tempPathFor(a.path)
+	if abort || a.err != nil {
+		a.file.Close()
+		os.Remove(tempPath)
+		if a.err != nil {
+			return a.err
+		}
+		return nil
+	}
+
+	var err error
+	if a.zw != nil {
+		err = a.zw.Close()
+	} else {
+		err = a.tw.Close()
+		if a.gz != nil {
+			err = errors.Join(err, a.gz.Close())
+		}
+	}
+	if err == nil {
+		err = a.file.Sync()
+	}
+	err = errors.Join(err, a.file.Close())
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de terminer l'archive: %w", err)
+	}
+	if err := os.Rename(tempPath, a.path); err != nil {
+		return fmt.Errorf("impossible de renommer l'archive: %w", err)
+	}
+	return nil
+}
+
+// archiveFile prépare un fichier de la liste et le confie au rédacteur de l'archive
+func archiveFile(source string, id int, name string, config *Config, logger *log.Logger) error {
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	// Traiter les liens symboliques selon le mode configuré
+	entry := archiveEntry{name: name, source: source}
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		switch config.SymlinkMode {
+		case SymlinkCopy:
+			entry.link, err = os.Readlink(source)
+			if err != nil {
+				return err
+			}
+		case SymlinkSkip:
+			return skipCopy(id, source, "lien symbolique", logger)
+		case SymlinkRefuse:
+			return fmt.Errorf("%w: %s est un lien symbolique", ErrCopyRefused, source)
+		default:
+			sourceInfo, err = os.Stat(source)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	entry.info = sourceInfo
+
+	// Ignorer les fichiers spéciaux, dont la lecture pourrait bloquer le worker
+	if entry.link == "" {
+		if reason := specialFileReason(sourceInfo.Mode()); reason != "" {
+			return skipCopy(id, source, reason, logger)
+		}
+		if err := readArchiveSource(&entry, config); err != nil {
+			return err
+		}
+	}
+
+	if err := config.archive.add(entry); err != nil {
+		if errors.Is(err, ErrCopyIgnored) {
+			return skipCopy(id, source, "déjà présent dans l'archive", logger)
+		}
+		return err
+	}
+
+	if entry.digest != "" {
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), formatDigest(config.HashAlgorithm, entry.digest))
+	}
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s)\n", id, filepath.Base(source), usedArchive)
+	config.stats.add(usedArchive, sourceInfo.Size())
+	config.limiter.count(sourceInfo.Size())
+	return nil
+}
+
+// readArchiveSource lit les petits fichiers en mémoire et calcule l'empreinte de la source,
+// en parallèle dans chaque worker
+func readArchiveSource(entry *archiveEntry, config *Config) error {
+	if entry.info.Size() > archiveBufferLimit && !config.VerifyHash {
+		return nil
+	}
+	sourceFile, err := os.Open(entry.source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	var reader io.Reader = sourceFile
+	var hasher hash.Hash
+	if config.VerifyHash {
+		if hasher, err = newHasher(config.HashAlgorithm); err != nil {
+			return err
+		}
+		reader = io.TeeReader(sourceFile, hasher)
+	}
+	if entry.info.Size() <= archiveBufferLimit {
+		entry.data, err = io.ReadAll(io.LimitReader(reader, entry.info.Size()))
+		if err == nil && int64(len(entry.data)) != entry.info.Size() {
+			err = fmt.Errorf("%d octets lus sur %d", len(entry.data), entry.info.Size())
+		}
+	} else {
+		_, err = io.Copy(io.Discard, reader)
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lors de la lecture de la source: %w", err)
+	}
+	if hasher != nil {
+		entry.digest = fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+	return nil
+}
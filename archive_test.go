@@ -0,0 +1,168 @@
+// archive_test.go
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveFormat(t *testing.T) {
+	cases := map[string]string{
+		"/partage/livraison.tar":    ArchiveTar,
+		"/partage/livraison.tar.gz": ArchiveTarGz,
+		"/partage/livraison.TGZ":    ArchiveTarGz,
+		"/partage/livraison.zip":    ArchiveZip,
+		"/partage/livraison":        "",
+	}
+	for path, want := range cases {
+		if got := archiveFormat(path); got != want {
+			t.Errorf("archiveFormat(%q) = %q, attendu %q", path, got, want)
+		}
+	}
+}
+
+// archiveTestSource crée les fichiers source et retourne la liste et la date appliquée
+func archiveTestSource(t *testing.T, dir string) ([]string, time.Time) {
+	t.Helper()
+	mtime := time.Date(2023, 5, 17, 10, 30, 0, 0, time.UTC)
+	files := []string{"a.flac", "disque 1/b.flac", "disque 1/pochette.jpg"}
+	for i, file := range files {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(strings.Repeat(file, 100*(i+1))), 0640); err != nil {
+			t.Fatalf("Erreur lors de l'écriture du fichier source: %v", err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	return files, mtime
+}
+
+func TestCopyFiles_TarGzArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "archive")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files, mtime := archiveTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "livraison.tar.gz"), ThreadCount: 3, VerifyHash: true, HashAlgorithm: "sha256"}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de l'écriture de l'archive: %v", err)
+	}
+	if _, err := os.Stat(tempPathFor(config.DestDir)); !os.IsNotExist(err) {
+		t.Errorf("L'archive temporaire ne devrait plus exister")
+	}
+
+	archive, err := os.Open(config.DestDir)
+	if err != nil {
+		t.Fatalf("Archive introuvable: %v", err)
+	}
+	defer archive.Close()
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatalf("Archive gzip invalide: %v", err)
+	}
+	reader := tar.NewReader(gz)
+	found := map[string]bool{}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Archive tar invalide: %v", err)
+		}
+		content, _ := io.ReadAll(reader)
+		want, _ := os.ReadFile(filepath.Join(sourceDir, header.Name))
+		if string(content) != string(want) {
+			t.Errorf("Contenu incorrect pour %s", header.Name)
+		}
+		if header.FileInfo().Mode().Perm() != 0640 {
+			t.Errorf("Mode incorrect pour %s: %v", header.Name, header.FileInfo().Mode())
+		}
+		if !header.ModTime.Equal(mtime) {
+			t.Errorf("Date incorrecte pour %s: %v", header.Name, header.ModTime)
+		}
+		found[header.Name] = true
+	}
+	for _, file := range files {
+		if !found[file] {
+			t.Errorf("%s absent de l'archive", file)
+		}
+	}
+}
+
+func TestCopyFiles_ZipArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "archive")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files, mtime := archiveTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "livraison.zip"), ThreadCount: 2}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de l'écriture de l'archive: %v", err)
+	}
+
+	reader, err := zip.OpenReader(config.DestDir)
+	if err != nil {
+		t.Fatalf("Archive zip invalide: %v", err)
+	}
+	defer reader.Close()
+	if len(reader.File) != len(files) {
+		t.Fatalf("Nombre d'entrées incorrect: attendu %d, obtenu %d", len(files), len(reader.File))
+	}
+	for _, entry := range reader.File {
+		rc, err := entry.Open()
+		if err != nil {
+			t.Fatalf("Entrée %s illisible: %v", entry.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		want, _ := os.ReadFile(filepath.Join(sourceDir, entry.Name))
+		if string(content) != string(want) {
+			t.Errorf("Contenu incorrect pour %s", entry.Name)
+		}
+		if entry.Mode().Perm() != 0640 {
+			t.Errorf("Mode incorrect pour %s: %v", entry.Name, entry.Mode())
+		}
+		if !entry.Modified.Equal(mtime) {
+			t.Errorf("Date incorrecte pour %s: %v", entry.Name, entry.Modified)
+		}
+	}
+}
+
+func TestArchiveWriter_Abort(t *testing.T) {
+	dir, err := os.MkdirTemp("", "archive")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "livraison.tar")
+	archive, err := openArchive(path, &Config{})
+	if err != nil {
+		t.Fatalf("Erreur inattendue à l'ouverture de l'archive: %v", err)
+	}
+	if err := archive.Close(true); err != nil {
+		t.Fatalf("Erreur inattendue à l'abandon de l'archive: %v", err)
+	}
+	// Une archive interrompue n'est jamais publiée
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("L'archive abandonnée ne devrait pas exister")
+	}
+	if _, err := os.Stat(tempPathFor(path)); !os.IsNotExist(err) {
+		t.Errorf("L'archive temporaire aurait dû être supprimée")
+	}
+}
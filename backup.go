@@ -0,0 +1,207 @@
+// backup.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modes de sauvegarde des fichiers de destination remplacés
+const (
+	BackupModeSuffix = "suffix" // renommer l'ancienne version avec un suffixe horodaté à côté du fichier
+	BackupModeDir    = "dir"    // déplacer l'ancienne version dans une arborescence de sauvegarde parallèle
+)
+
+var backupModes = []string{BackupModeSuffix, BackupModeDir}
+
+// Format de l'horodatage des sauvegardes: <nom>.<horodatage>[.<n>].bak
+const (
+	backupTimeLayout = "20060102-150405"
+	backupExt        = ".bak"
+)
+
+// normalizeBackupMode valide le mode de sauvegarde ("" la désactive). Un répertoire de
+// sauvegarde sans mode explicite active le mode dir.
+func normalizeBackupMode(mode, dir string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		if dir != "" {
+			return BackupModeDir, nil
+		}
+		return "", nil
+	case BackupModeSuffix, BackupModeDir:
+	case "tree":
+		mode = BackupModeDir
+	default:
+		return "", fmt.Errorf("mode de sauvegarde inconnu %q (disponibles: %s)", mode, strings.Join(backupModes, ", "))
+	}
+	if mode == BackupModeDir && dir == "" {
+		return "", fmt.Errorf("le mode de sauvegarde dir exige BACKUP_DIR")
+	}
+	return mode, nil
+}
+
+// backupVersion est une sauvegarde existante d'un fichier
+type backupVersion struct {
+	name  string
+	stamp string
+	seq   int
+}
+
+// parseBackupName reconnaît une sauvegarde du fichier base
+func parseBackupName(name, base string) (backupVersion, bool) {
+	rest, ok := strings.CutPrefix(name, base+".")
+	if !ok {
+		return backupVersion{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, backupExt)
+	if !ok {
+		return backupVersion{}, false
+	}
+	stamp, seqStr, hasSeq := strings.Cut(rest, ".")
+	if _, err := time.Parse(backupTimeLayout, stamp); err != nil {
+		return backupVersion{}, false
+	}
+	seq := 0
+	if hasSeq {
+		n, err := strconv.Atoi(seqStr)
+		if err != nil || n < 1 {
+			return backupVersion{}, false
+		}
+		seq = n
+	}
+	return backupVersion{name: name, stamp: stamp, seq: seq}, true
+}
+
+// backupVersions retourne les sauvegardes du fichier base dans dir, de la plus ancienne
+// à la plus récente
+func backupVersions(dir, base string) ([]backupVersion, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var versions []backupVersion
+	for _, entry := range entries {
+		if v, ok := parseBackupName(entry.Name(), base); ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].stamp != versions[j].stamp {
+			return versions[i].stamp < versions[j].stamp
+		}
+		return versions[i].seq < versions[j].seq
+	})
+	return versions, nil
+}
+
+// backupPath retourne un nom de sauvegarde libre pour le fichier de destination
+func backupPath(dest string, now time.Time, config *Config) (string, error) {
+	dir, base := filepath.Dir(dest), filepath.Base(dest)
+	if config.BackupMode == BackupModeDir {
+		rel, err := filepath.Rel(config.DestDir, dest)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s hors de DEST_DIR, pas de sauvegarde possible", dest)
+		}
+		dir = filepath.Join(config.BackupDir, filepath.Dir(rel))
+	}
+	stamp := now.Format(backupTimeLayout)
+	for seq := 0; ; seq++ {
+		name := base + "." + stamp + backupExt
+		if seq > 0 {
+			name = base + "." + stamp + "." + strconv.Itoa(seq) + backupExt
+		}
+		path := filepath.Join(dir, name)
+		_, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("impossible de choisir le nom de sauvegarde de %s: %w", dest, err)
+		}
+	}
+}
+
+// backupDestination conserve la version actuelle de la destination avant son remplacement.
+// Elle est liée sous son nom de sauvegarde pour que la destination reste en place jusqu'au
+// renommage final, ou copiée si le lien est impossible. Les versions au-delà de la limite
+// de conservation sont supprimées.
+func backupDestination(id int, dest string, config *Config, logger *log.Logger) error {
+	info, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	backup, err := backupPath(dest, time.Now(), config)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), os.ModePerm); err != nil {
+		return fmt.Errorf("impossible de créer le répertoire de sauvegarde: %w", err)
+	}
+	if err := os.Link(dest, backup); err != nil {
+		if err := copyBackup(dest, backup, info); err != nil {
+			os.Remove(backup)
+			return fmt.Errorf("impossible de sauvegarder %s: %w", dest, err)
+		}
+	}
+	logger.Printf("Worker %d: Ancienne version de %s conservée dans %s\n", id, dest, backup)
+
+	if config.BackupKeep > 0 {
+		pruneBackups(id, filepath.Dir(backup), filepath.Base(dest), config.BackupKeep, logger)
+	}
+	return nil
+}
+
+// copyBackup copie l'ancienne version avec son mode et sa date
+func copyBackup(dest, backup string, info os.FileInfo) error {
+	src, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(backup, info.ModTime(), info.ModTime())
+}
+
+// pruneBackups supprime les sauvegardes les plus anciennes au-delà de keep versions
+func pruneBackups(id int, dir, base string, keep int, logger *log.Logger) {
+	versions, err := backupVersions(dir, base)
+	if err != nil {
+		logger.Printf("Worker %d: Impossible de lister les sauvegardes de %s: %v\n", id, base, err)
+		return
+	}
+	for len(versions) > keep {
+		path := filepath.Join(dir, versions[0].name)
+		if err := os.Remove(path); err != nil {
+			logger.Printf("Worker %d: Impossible de supprimer l'ancienne sauvegarde %s: %v\n", id, path, err)
+		} else {
+			logger.Printf("Worker %d: Sauvegarde %s supprimée (limite de %d versions)\n", id, path, keep)
+		}
+		versions = versions[1:]
+	}
+}
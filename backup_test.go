@@ -0,0 +1,135 @@
+// backup_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeVersion écrit une nouvelle version de la source, plus récente que la destination
+func writeVersion(t *testing.T, path, content string, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Erreur lors de l'écriture de %s: %v", path, err)
+	}
+	mtime := time.Now().Add(-age)
+	os.Chtimes(path, mtime, mtime)
+}
+
+func TestCopyFile_BackupSuffix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest", "master.flac")
+	config := &Config{DestDir: filepath.Join(dir, "dest"), BackupMode: BackupModeSuffix, BackupKeep: 2}
+
+	// Quatre versions successives: seules les deux sauvegardes les plus récentes restent
+	for i, content := range []string{"version 1", "version 2 plus longue", "version 3", "v4"} {
+		writeVersion(t, source, content, time.Duration(10-i)*time.Hour)
+		if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+			t.Fatalf("Erreur inattendue lors de la copie %d: %v", i+1, err)
+		}
+	}
+
+	current, _ := os.ReadFile(dest)
+	if string(current) != "v4" {
+		t.Errorf("Contenu de la destination incorrect: %q", string(current))
+	}
+	versions, err := backupVersions(filepath.Dir(dest), "master.flac")
+	if err != nil {
+		t.Fatalf("Erreur inattendue lors de la lecture des sauvegardes: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Deux sauvegardes attendues, obtenu %d", len(versions))
+	}
+	oldest, _ := os.ReadFile(filepath.Join(filepath.Dir(dest), versions[0].name))
+	newest, _ := os.ReadFile(filepath.Join(filepath.Dir(dest), versions[1].name))
+	if string(oldest) != "version 2 plus longue" || string(newest) != "version 3" {
+		t.Errorf("Sauvegardes incorrectes: %q, %q", string(oldest), string(newest))
+	}
+}
+
+func TestCopyFile_BackupDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	destDir := filepath.Join(dir, "dest")
+	dest := filepath.Join(destDir, "album", "piste.flac")
+	backupDir := filepath.Join(dir, "sauvegardes")
+	config := &Config{DestDir: destDir, BackupMode: BackupModeDir, BackupDir: backupDir}
+
+	writeVersion(t, source, "ancienne", 2*time.Hour)
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la première copie: %v", err)
+	}
+	// La première copie ne remplace rien
+	if _, err := os.Stat(backupDir); !os.IsNotExist(err) {
+		t.Errorf("Aucune sauvegarde attendue lors de la première copie")
+	}
+
+	writeVersion(t, source, "nouvelle version", time.Hour)
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la seconde copie: %v", err)
+	}
+	versions, err := backupVersions(filepath.Join(backupDir, "album"), "piste.flac")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("Une sauvegarde attendue dans l'arborescence parallèle: %v, %v", versions, err)
+	}
+	saved, _ := os.ReadFile(filepath.Join(backupDir, "album", versions[0].name))
+	if string(saved) != "ancienne" {
+		t.Errorf("Contenu de la sauvegarde incorrect: %q", string(saved))
+	}
+}
+
+func TestParseBackupName(t *testing.T) {
+	cases := map[string]bool{
+		"piste.flac.20261017-153000.bak":   true,
+		"piste.flac.20261017-153000.2.bak": true,
+		"piste.flac.20261017.bak":          false,
+		"autre.flac.20261017-153000.bak":   false,
+		"piste.flac":                       false,
+	}
+	for name, want := range cases {
+		if _, ok := parseBackupName(name, "piste.flac"); ok != want {
+			t.Errorf("parseBackupName(%q) = %v, attendu %v", name, ok, want)
+		}
+	}
+}
+
+func TestNormalizeBackupMode(t *testing.T) {
+	if mode, err := normalizeBackupMode("", "/sauvegardes"); err != nil || mode != BackupModeDir {
+		t.Errorf("Mode dir attendu avec un répertoire de sauvegarde, obtenu %q, %v", mode, err)
+	}
+	if _, err := normalizeBackupMode("dir", ""); err == nil {
+		t.Errorf("Une erreur était attendue sans répertoire de sauvegarde")
+	}
+	if _, err := normalizeBackupMode("versions", ""); err == nil {
+		t.Errorf("Une erreur était attendue pour un mode inconnu")
+	}
+}
+
+func TestBackupPath_Unreachable(t *testing.T) {
+	dir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Le répertoire de sauvegarde est un fichier: aucun nom ne peut être libre
+	blocker := filepath.Join(dir, "sauvegardes")
+	os.WriteFile(blocker, nil, 0644)
+	config := &Config{DestDir: filepath.Join(dir, "dest"), BackupMode: BackupModeDir, BackupDir: blocker}
+	if _, err := backupPath(filepath.Join(config.DestDir, "piste.flac"), time.Now(), config); err == nil {
+		t.Errorf("Une erreur était attendue pour un répertoire de sauvegarde inaccessible")
+	}
+}
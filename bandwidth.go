@@ -0,0 +1,228 @@
+// bandwidth.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Multiplicateurs des unités acceptées dans les tailles et débits
+var rateUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+}
+
+// Intervalle de relecture du fichier de limite de bande passante
+const bandwidthPollInterval = 5 * time.Second
+
+// parseRate convertit un débit ("50MB/s", "500KiB", "1.5GB/s") en octets par seconde.
+// Une valeur vide ou nulle signifie illimité.
+func parseRate(value string) (float64, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	return parseBytes(value)
+}
+
+// parseSize convertit une taille ("1GB", "64MiB") en octets
+func parseSize(value string) (int64, error) {
+	n, err := parseBytes(value)
+	return int64(n), err
+}
+
+// parseBytes convertit un nombre suivi d'une unité d'octets optionnelle
+func parseBytes(value string) (float64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	number, unit := value, ""
+	if i >= 0 {
+		number, unit = value[:i], strings.TrimSpace(value[i:])
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("valeur invalide %q", value)
+	}
+	multiplier, ok := rateUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unité inconnue %q", unit)
+	}
+	return n * multiplier, nil
+}
+
+// formatBytes affiche une quantité d'octets en unités décimales
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1000 && i < len(units)-1 {
+		n /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// rateLimiter est un seau à jetons partagé par tous les workers. Un débit nul signifie
+// illimité; le débit peut être modifié pendant la copie.
+type rateLimiter struct {
+	mu          sync.Mutex
+	rate        float64 // octets par seconde
+	tokens      float64
+	last        time.Time
+	transferred atomic.Int64
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, last: time.Now()}
+}
+
+// limit retourne le débit maximal courant (0 si illimité)
+func (l *rateLimiter) limit() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// setLimit modifie le débit maximal
+func (l *rateLimiter) setLimit(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// wait consomme n jetons et bloque le temps nécessaire pour respecter le débit
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+	// Autoriser au plus une seconde de rafale
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// count enregistre les octets transférés, pour l'affichage du débit
+func (l *rateLimiter) count(n int64) {
+	if l == nil {
+		return
+	}
+	l.transferred.Add(n)
+}
+
+// bytes retourne le total des octets transférés
+func (l *rateLimiter) bytes() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.transferred.Load()
+}
+
+// Taille maximale d'une écriture soumise au limiteur, pour lisser le débit
+const throttleChunk = 32 * 1024
+
+// throttledWriter soumet chaque écriture au limiteur de débit
+type throttledWriter struct {
+	w       io.Writer
+	limiter *rateLimiter
+}
+
+func (t throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+		t.limiter.wait(len(chunk))
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// throttledReader soumet chaque lecture au limiteur de débit
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	t.limiter.wait(len(p))
+	return t.r.Read(p)
+}
+
+// watchBandwidthFile relit périodiquement le fichier de limite et applique les changements
+// jusqu'à la fermeture de stopCh
+func watchBandwidthFile(path string, limiter *rateLimiter, stopCh <-chan struct{}, logger *log.Logger) {
+	ticker := time.NewTicker(bandwidthPollInterval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		content, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(content)) != last {
+			last = strings.TrimSpace(string(content))
+			rate, err := parseRate(last)
+			if err != nil {
+				logger.Printf("Limite de bande passante ignorée dans %s: %v\n", path, err)
+			} else if rate != limiter.limit() {
+				limiter.setLimit(rate)
+				logger.Printf("Limite de bande passante modifiée: %s\n", describeLimit(rate))
+			}
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// describeLimit affiche une limite de débit
+func describeLimit(rate float64) string {
+	if rate <= 0 {
+		return "illimitée"
+	}
+	return formatBytes(rate) + "/s"
+}
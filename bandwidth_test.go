@@ -0,0 +1,58 @@
+// bandwidth_test.go
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]float64{
+		"":          0,
+		"0":         0,
+		"50MB/s":    50 * 1000 * 1000,
+		"500 KiB/s": 500 * 1024,
+		"1.5GB":     1.5 * 1000 * 1000 * 1000,
+		"2048":      2048,
+	}
+	for input, expected := range cases {
+		got, err := parseRate(input)
+		if err != nil || got != expected {
+			t.Errorf("parseRate(%q) attendu %v, obtenu %v (%v)", input, expected, got, err)
+		}
+	}
+	for _, input := range []string{"vite", "10 parsecs/s", "-5MB/s"} {
+		if _, err := parseRate(input); err == nil {
+			t.Errorf("Une erreur était attendue pour %q", input)
+		}
+	}
+}
+
+func TestRateLimiter_Throttles(t *testing.T) {
+	limiter := newRateLimiter(500 * 1000)
+	var out bytes.Buffer
+	writer := throttledWriter{w: &out, limiter: limiter}
+
+	// 100 Ko à 500 Ko/s, sans rafale initiale: au moins 0,2 s
+	data := []byte(strings.Repeat("x", 100*1000))
+	start := time.Now()
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Erreur inattendue lors de l'écriture: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Écriture trop rapide pour la limite: %v", elapsed)
+	}
+	if out.Len() != len(data) {
+		t.Errorf("Taille écrite attendue %d, obtenue %d", len(data), out.Len())
+	}
+
+	// Une limite nulle désactive la régulation
+	limiter.setLimit(0)
+	start = time.Now()
+	writer.Write(data)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Écriture ralentie sans limite: %v", elapsed)
+	}
+}
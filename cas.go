@@ -0,0 +1,311 @@
+// cas.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Modes du stockage par contenu: chaque contenu est écrit une seule fois sous son
+// empreinte, les chemins de la liste étant des liens physiques vers lui ou des entrées
+// d'un fichier d'index
+const (
+	CASLink  = "link"  // créer chaque chemin de la liste comme lien physique vers le contenu
+	CASIndex = "index" // enregistrer les chemins dans l'index sans les créer
+)
+
+var casModes = []string{CASLink, CASIndex}
+
+// Organisation du stockage dans DEST_DIR: .cas/sha256/ab/cd/<empreinte> et .cas/index.tsv
+const (
+	casDir       = ".cas"
+	casAlgorithm = "sha256"
+	casIndexFile = "index.tsv"
+)
+
+// Méthode rapportée pour les fichiers dont le contenu était déjà stocké
+const usedDedup = "dedup"
+
+// normalizeCASMode valide le mode du stockage par contenu ("" le désactive)
+func normalizeCASMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", CASLink, CASIndex:
+		return mode, nil
+	case "hardlink", "true":
+		return CASLink, nil
+	}
+	return "", fmt.Errorf("mode de stockage par contenu inconnu %q (disponibles: %s)", mode, strings.Join(casModes, ", "))
+}
+
+// casObject est un contenu en cours d'écriture ou écrit pendant l'exécution
+type casObject struct {
+	done chan struct{}
+	err  error
+}
+
+// casIndexEntry est le contenu associé à un chemin de la liste dans l'index
+type casIndexEntry struct {
+	digest string
+	size   int64
+}
+
+// casStore gère les contenus stockés sous DEST_DIR et l'index des chemins
+type casStore struct {
+	root    string
+	mode    string
+	mu      sync.Mutex
+	objects map[string]*casObject
+	index   map[string]casIndexEntry
+}
+
+// openCASStore prépare le stockage et charge l'index existant en mode index
+func openCASStore(destDir, mode string) (*casStore, error) {
+	s := &casStore{root: destDir, mode: mode, objects: make(map[string]*casObject), index: make(map[string]casIndexEntry)}
+	if mode != CASIndex {
+		return s, nil
+	}
+	file, err := os.Open(s.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lire l'index: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("index %s invalide à la ligne %d", s.indexPath(), line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("index %s invalide à la ligne %d: %v", s.indexPath(), line, err)
+		}
+		s.index[fields[2]] = casIndexEntry{digest: strings.TrimPrefix(fields[0], casAlgorithm+":"), size: size}
+	}
+	return s, scanner.Err()
+}
+
+// indexPath retourne le chemin du fichier d'index
+func (s *casStore) indexPath() string {
+	return filepath.Join(s.root, casDir, casIndexFile)
+}
+
+// objectPath retourne le chemin du contenu d'empreinte donnée, réparti sur deux niveaux
+// de répertoires
+func (s *casStore) objectPath(digest string) string {
+	return filepath.Join(s.root, casDir, casAlgorithm, digest[:2], digest[2:4], digest)
+}
+
+// store s'assure que le contenu est présent, en l'écrivant avec write si nécessaire. Un
+// même contenu n'est écrit que par un seul worker, les autres attendent son résultat.
+// Retourne true si le contenu était déjà présent.
+func (s *casStore) store(digest string, size int64, verify bool, write func(object string) error) (bool, error) {
+	s.mu.Lock()
+	obj, ok := s.objects[digest]
+	if ok {
+		s.mu.Unlock()
+		<-obj.done
+		return true, obj.err
+	}
+	obj = &casObject{done: make(chan struct{})}
+	s.objects[digest] = obj
+	s.mu.Unlock()
+	defer func() {
+		// Un échec n'est pas mémorisé: la tentative suivante réécrit le contenu
+		if obj.err != nil {
+			s.mu.Lock()
+			delete(s.objects, digest)
+			s.mu.Unlock()
+		}
+		close(obj.done)
+	}()
+
+	object := s.objectPath(digest)
+	if info, err := os.Stat(object); err == nil && info.Size() == size {
+		// Contenu d'une exécution précédente, relu avant d'être réutilisé si demandé
+		if !verify {
+			return true, nil
+		}
+		existing, err := fileHash(object, casAlgorithm)
+		if err != nil {
+			obj.err = err
+			return false, err
+		}
+		if existing == digest {
+			return true, nil
+		}
+	}
+
+	// Un contenu présent mais qui ne correspond pas à son empreinte est corrompu: il est
+	// supprimé pour que write ne lui applique pas la politique de comparaison des chemins
+	if err := os.Remove(object); err != nil && !errors.Is(err, os.ErrNotExist) {
+		obj.err = fmt.Errorf("impossible de remplacer le contenu corrompu %s: %w", object, err)
+		return false, obj.err
+	}
+	if err := os.MkdirAll(filepath.Dir(object), os.ModePerm); err != nil {
+		obj.err = fmt.Errorf("impossible de créer les répertoires du stockage: %w", err)
+		return false, obj.err
+	}
+	obj.err = write(object)
+	return false, obj.err
+}
+
+// record associe un chemin de la liste à un contenu dans l'index
+func (s *casStore) record(file, digest string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index[filepath.ToSlash(file)] = casIndexEntry{digest: digest, size: size}
+}
+
+// indexed retourne le contenu associé à un chemin de la liste dans l'index
+func (s *casStore) indexed(file string) (casIndexEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.index[filepath.ToSlash(file)]
+	return entry, ok
+}
+
+// saveIndex réécrit l'index trié par chemin, via un fichier temporaire
+func (s *casStore) saveIndex() error {
+	if s.mode != CASIndex {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.index))
+	for path := range s.index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		entry := s.index[path]
+		fmt.Fprintf(&b, "%s:%s\t%d\t%s\n", casAlgorithm, entry.digest, entry.size, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.indexPath()), os.ModePerm); err != nil {
+		return err
+	}
+	tempPath := tempPathFor(s.indexPath())
+	if err := os.WriteFile(tempPath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("impossible d'écrire l'index: %w", err)
+	}
+	return os.Rename(tempPath, s.indexPath())
+}
+
+// casFile stocke le contenu d'un fichier de la liste sous son empreinte, sans transfert
+// s'il est déjà présent, puis crée son chemin logique ou l'enregistre dans l'index
+func casFile(source string, id int, file, dest string, config *Config, logger *log.Logger) error {
+	store := config.cas
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	// Traiter les liens symboliques selon le mode configuré
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		switch config.SymlinkMode {
+		case SymlinkCopy:
+			if store.mode == CASIndex {
+				return skipCopy(id, source, "lien symbolique non représentable dans l'index", logger)
+			}
+			if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+				return fmt.Errorf("impossible de créer les répertoires de destination: %w", err)
+			}
+			return copySymlink(source, id, dest, logger)
+		case SymlinkSkip:
+			return skipCopy(id, source, "lien symbolique", logger)
+		case SymlinkRefuse:
+			return fmt.Errorf("%w: %s est un lien symbolique", ErrCopyRefused, source)
+		}
+		if sourceInfo, err = os.Stat(source); err != nil {
+			return err
+		}
+	}
+	if reason := specialFileReason(sourceInfo.Mode()); reason != "" {
+		return skipCopy(id, source, reason, logger)
+	}
+
+	// Chemin logique déjà créé et inchangé selon la politique de comparaison
+	if store.mode == CASLink {
+		if _, err := os.Stat(dest); err == nil {
+			same, reason, err := filesAreEqual(source, dest, config)
+			if err != nil {
+				return err
+			}
+			if same {
+				return skipCopy(id, source, fmt.Sprintf("politique %s, %s", effectivePolicy(config), reason), logger)
+			}
+		}
+	}
+
+	digest, err := fileHash(source, casAlgorithm)
+	if err != nil {
+		return fmt.Errorf("erreur lors du hash de la source: %w", err)
+	}
+	if entry, ok := store.indexed(file); ok && entry.digest == digest {
+		return skipCopy(id, source, fmt.Sprintf("contenu déjà indexé (%s)", formatDigest(casAlgorithm, digest)), logger)
+	}
+
+	// Écrire le contenu une seule fois, avec les garanties de la copie ordinaire
+	reused, err := store.store(digest, sourceInfo.Size(), config.VerifyHash, func(object string) error {
+		return copyRegularFile(source, sourceInfo, id, object, config, logger)
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		logger.Printf("Worker %d: Contenu de %s déjà présent (%s), transfert évité\n", id, filepath.Base(source), formatDigest(casAlgorithm, digest))
+		config.stats.add(usedDedup, sourceInfo.Size())
+	}
+
+	if store.mode == CASIndex {
+		store.record(file, digest, sourceInfo.Size())
+		return nil
+	}
+	return linkObject(store.objectPath(digest), id, dest, config, logger)
+}
+
+// linkObject crée le chemin logique comme lien physique vers le contenu, en remplaçant
+// atomiquement une éventuelle version précédente
+func linkObject(object string, id int, dest string, config *Config, logger *log.Logger) error {
+	objectInfo, err := os.Stat(object)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(dest); err == nil && os.SameFile(objectInfo, destInfo) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return fmt.Errorf("impossible de créer les répertoires de destination: %w", err)
+	}
+	tempPath := tempPathFor(dest)
+	os.Remove(tempPath)
+	if err := os.Link(object, tempPath); err != nil {
+		return fmt.Errorf("impossible de lier %s au contenu: %w", dest, err)
+	}
+	if config.BackupMode != "" {
+		if err := backupDestination(id, dest, config, logger); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de renommer le lien: %w", err)
+	}
+	logger.Printf("Worker %d: %s lié au contenu %s\n", id, dest, filepath.Base(object))
+	return nil
+}
@@ -0,0 +1,174 @@
+// cas_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// casTestSource crée des pochettes dont deux sont identiques sous des noms différents
+func casTestSource(t *testing.T, dir string) []string {
+	t.Helper()
+	contents := map[string]string{
+		"album1/cover.jpg": "image identique",
+		"album2/front.jpg": "image identique",
+		"album3/cover.jpg": "autre image",
+	}
+	files := make([]string, 0, len(contents))
+	for name, content := range contents {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Erreur lors de l'écriture du fichier source: %v", err)
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
+// countObjects compte les contenus stockés
+func countObjects(t *testing.T, destDir string) int {
+	t.Helper()
+	count := 0
+	filepath.WalkDir(filepath.Join(destDir, casDir, casAlgorithm), func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func TestCopyFiles_CASLink(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cas")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 3, CASMode: CASLink}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+
+	if n := countObjects(t, config.DestDir); n != 2 {
+		t.Errorf("Nombre de contenus stockés incorrect: attendu 2, obtenu %d", n)
+	}
+	first, err := os.Stat(filepath.Join(config.DestDir, "album1/cover.jpg"))
+	if err != nil {
+		t.Fatalf("Chemin logique absent: %v", err)
+	}
+	second, err := os.Stat(filepath.Join(config.DestDir, "album2/front.jpg"))
+	if err != nil {
+		t.Fatalf("Chemin logique absent: %v", err)
+	}
+	if !os.SameFile(first, second) {
+		t.Errorf("Les fichiers identiques devraient partager le même contenu")
+	}
+	if n := config.stats.files[usedDedup]; n != 1 {
+		t.Errorf("Un fichier dédupliqué attendu, obtenu %d", n)
+	}
+}
+
+func TestCopyFiles_CASIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cas")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CASMode: CASIndex, VerifyHash: true}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "album1/cover.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Les chemins logiques ne devraient pas être créés en mode index")
+	}
+	index, err := os.ReadFile(filepath.Join(config.DestDir, casDir, casIndexFile))
+	if err != nil {
+		t.Fatalf("Index absent: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(index)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "\talbum1/cover.jpg") || !strings.HasPrefix(lines[0], "sha256:") {
+		t.Errorf("Index incorrect:\n%s", index)
+	}
+
+	// Une nouvelle exécution retrouve les chemins dans l'index sans rien transférer
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la seconde copie: %v", err)
+	}
+	if len(config.stats.files) != 0 {
+		t.Errorf("Aucun transfert attendu lors de la seconde copie: %v", config.stats.files)
+	}
+	if n := countObjects(t, config.DestDir); n != 2 {
+		t.Errorf("Nombre de contenus stockés incorrect: attendu 2, obtenu %d", n)
+	}
+}
+
+func TestNormalizeCASMode(t *testing.T) {
+	for value, want := range map[string]string{"": "", "LINK": CASLink, "hardlink": CASLink, "index": CASIndex} {
+		got, err := normalizeCASMode(value)
+		if err != nil || got != want {
+			t.Errorf("normalizeCASMode(%q) = %q, %v; attendu %q", value, got, err, want)
+		}
+	}
+	if _, err := normalizeCASMode("copie"); err == nil {
+		t.Errorf("Une erreur était attendue pour un mode inconnu")
+	}
+}
+
+func TestCopyFiles_CASReplacesCorruptObject(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cas")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 3, CASMode: CASLink, ComparePolicy: PolicyNever}
+
+	// Contenu tronqué laissé par une exécution précédente, sous l'empreinte de la source
+	digest, err := fileHash(filepath.Join(sourceDir, "album1/cover.jpg"), casAlgorithm)
+	if err != nil {
+		t.Fatalf("Erreur lors du hash de la source: %v", err)
+	}
+	store, _ := openCASStore(config.DestDir, CASLink)
+	object := store.objectPath(digest)
+	os.MkdirAll(filepath.Dir(object), 0755)
+	if err := os.WriteFile(object, []byte("image"), 0644); err != nil {
+		t.Fatalf("Erreur lors de l'écriture du contenu: %v", err)
+	}
+
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	for _, name := range []string{"album1/cover.jpg", "album2/front.jpg"} {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, name))
+		if err != nil || string(content) != "image identique" {
+			t.Errorf("Contenu de %s incorrect: %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestCopyFiles_CASRejectsEncryption(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cas")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 1, CASMode: CASLink, EncryptionKey: make([]byte, 32)}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err == nil {
+		t.Errorf("Une erreur était attendue pour le stockage par contenu avec chiffrement")
+	}
+}
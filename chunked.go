@@ -0,0 +1,156 @@
+// chunked.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Taille par défaut des blocs copiés en parallèle
+const defaultChunkSize = 64 * 1000 * 1000
+
+// Méthode rapportée pour les copies par blocs
+const usedChunked = "chunked"
+
+// chunkedCopy décrit la copie par blocs d'un fichier volumineux vers son fichier temporaire
+type chunkedCopy struct {
+	name     string
+	src, dst *os.File
+	limiter  *rateLimiter
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	err      error
+}
+
+// fail mémorise la première erreur d'un bloc
+func (c *chunkedCopy) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// chunkJob est un bloc à copier, exécuté par le worker propriétaire du fichier ou par un
+// worker inoccupé
+type chunkJob struct {
+	copy           *chunkedCopy
+	offset, length int64
+}
+
+// run copie le bloc avec ses propres tentatives
+func (j chunkJob) run(id int, logger *log.Logger) {
+	defer j.copy.wg.Done()
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		if err = copyRange(j.copy.dst, j.copy.src, j.offset, j.length, j.copy.limiter); err == nil {
+			return
+		}
+		if attempt < maxRetries {
+			logger.Printf("Worker %d: Erreur sur le bloc %d-%d de %s, nouvelle tentative (%d/%d): %v\n",
+				id, j.offset, j.offset+j.length, j.copy.name, attempt, maxRetries, err)
+			time.Sleep(2 * time.Second)
+		}
+	}
+	j.copy.fail(fmt.Errorf("échec du bloc %d-%d après %d tentatives: %w", j.offset, j.offset+j.length, maxRetries, err))
+}
+
+// copyRange copie une plage d'octets avec ReadAt/WriteAt, sans toucher aux positions des fichiers
+func copyRange(dst, src *os.File, offset, length int64, limiter *rateLimiter) error {
+	var writer io.Writer = io.NewOffsetWriter(dst, offset)
+	if limiter != nil {
+		writer = throttledWriter{w: writer, limiter: limiter}
+	}
+	n, err := io.Copy(writer, io.NewSectionReader(src, offset, length))
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("%d octets copiés sur %d", n, length)
+	}
+	return nil
+}
+
+// copyChunked copie un fichier volumineux par blocs. Chaque bloc est proposé aux workers
+// inoccupés et copié par le worker propriétaire si aucun n'est disponible.
+func copyChunked(source string, sourceInfo os.FileInfo, id int, dest string, config *Config, logger *log.Logger) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	// Les blocs étant écrits dans le désordre, une copie partielle ne peut pas être reprise
+	tempPath := tempPathFor(dest)
+	destFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	abort := func(err error) error {
+		destFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := destFile.Truncate(sourceInfo.Size()); err != nil {
+		return abort(fmt.Errorf("impossible de dimensionner le fichier temporaire: %w", err))
+	}
+
+	chunkSize := config.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	c := &chunkedCopy{name: filepath.Base(source), src: sourceFile, dst: destFile, limiter: config.limiter}
+	chunks := 0
+	for offset := int64(0); offset < sourceInfo.Size(); offset += chunkSize {
+		job := chunkJob{copy: c, offset: offset, length: min(chunkSize, sourceInfo.Size()-offset)}
+		c.wg.Add(1)
+		chunks++
+		select {
+		case config.chunkCh <- job:
+		default:
+			job.run(id, logger)
+		}
+	}
+	c.wg.Wait()
+	if c.err != nil {
+		return abort(fmt.Errorf("erreur lors de la copie par blocs: %w", c.err))
+	}
+
+	// Forcer l'écriture sur disque avant le renommage
+	if err := destFile.Sync(); err != nil {
+		return abort(fmt.Errorf("impossible de synchroniser le fichier temporaire: %w", err))
+	}
+	if err := destFile.Close(); err != nil {
+		return abort(fmt.Errorf("impossible de fermer le fichier temporaire: %w", err))
+	}
+
+	// Vérification du fichier complet, les blocs n'ayant pas été hachés dans l'ordre
+	if config.VerifyHash {
+		sourceDigest, err := fileHash(source, config.HashAlgorithm)
+		if err != nil {
+			return abort(fmt.Errorf("erreur lors du hash de la source: %w", err))
+		}
+		if err := verifyCopy(tempPath, sourceDigest, config.HashAlgorithm); err != nil {
+			return abort(err)
+		}
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), formatDigest(config.HashAlgorithm, sourceDigest))
+		if err := checkCopiedDigest(id, source, sourceDigest, config, logger); err != nil {
+			return abort(err)
+		}
+	}
+
+	if err := commitTempFile(tempPath, source, sourceInfo, id, dest, config, logger); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s, %d blocs)\n", id, filepath.Base(source), usedChunked, chunks)
+	config.stats.add(usedChunked, sourceInfo.Size())
+	config.limiter.count(sourceInfo.Size())
+	return nil
+}
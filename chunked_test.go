@@ -0,0 +1,58 @@
+// chunked_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyFile_Chunked(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chunked")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("0123456789abcdef", 4096)
+	source := filepath.Join(dir, "master.wav")
+	dest := filepath.Join(dir, "out", "master.wav")
+	os.WriteFile(source, []byte(content), 0644)
+
+	config := &Config{
+		ChunkThreshold: 1000,
+		ChunkSize:      3000,
+		VerifyHash:     true,
+		HashAlgorithm:  "xxh64",
+		chunkCh:        make(chan chunkJob),
+	}
+
+	// Un second worker inoccupé prend en charge une partie des blocs
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		for {
+			select {
+			case job := <-config.chunkCh:
+				job.run(2, InitTestLogger())
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie par blocs: %v", err)
+	}
+	copied, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Erreur lors de la lecture du fichier destination: %v", err)
+	}
+	if string(copied) != content {
+		t.Errorf("Contenu du fichier destination incorrect après la copie par blocs")
+	}
+	if _, err := os.Stat(tempPathFor(dest)); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire ne devrait plus exister")
+	}
+}
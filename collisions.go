@@ -0,0 +1,251 @@
+// collisions.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Traitement des noms qui se confondent sur une destination insensible à la casse ou à la
+// normalisation Unicode (NAS, partages SMB, volumes macOS)
+const (
+	CollisionAbort  = "abort"  // signaler les collisions et ne rien copier
+	CollisionRename = "rename" // renommer les fichiers en collision
+	CollisionNFC    = "nfc"    // écrire les noms en NFC, les collisions restantes arrêtant la copie
+)
+
+var collisionModes = []string{CollisionAbort, CollisionRename, CollisionNFC}
+
+// normalizeCollisionMode valide le mode de contrôle des collisions ("" le désactive)
+func normalizeCollisionMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", CollisionAbort, CollisionRename, CollisionNFC:
+		return mode, nil
+	case "normalize", "normalise":
+		return CollisionNFC, nil
+	}
+	return "", fmt.Errorf("mode de contrôle des collisions inconnu %q (disponibles: %s)", mode, strings.Join(collisionModes, ", "))
+}
+
+// collisionKey retourne la forme sous laquelle une destination insensible à la casse et à
+// la normalisation compare les noms: pliage de casse Unicode de la forme NFC
+func collisionKey(name string) string {
+	return norm.NFC.String(cases.Fold().String(norm.NFC.String(name)))
+}
+
+// destListing mémorise le contenu des répertoires de destination, indexé par clé de collision
+type destListing struct {
+	root string
+	dirs map[string]map[string]string // répertoire relatif -> clé -> nom existant
+}
+
+// entries retourne le contenu d'un répertoire de destination, vide s'il n'existe pas
+func (l *destListing) entries(dir string) map[string]string {
+	if entries, ok := l.dirs[dir]; ok {
+		return entries
+	}
+	entries := make(map[string]string)
+	if list, err := os.ReadDir(filepath.Join(l.root, dir)); err == nil {
+		for _, entry := range list {
+			if !strings.HasPrefix(entry.Name(), tempFilePrefix) {
+				entries[collisionKey(entry.Name())] = entry.Name()
+			}
+		}
+	}
+	l.dirs[dir] = entries
+	return entries
+}
+
+// existing retourne le chemin d'une entrée de la destination qui se confond avec le chemin
+// donné, ou "" si aucune
+func (l *destListing) existing(path string) string {
+	resolved := "."
+	for _, part := range strings.Split(path, string(filepath.Separator)) {
+		name, ok := l.entries(resolved)[collisionKey(part)]
+		if !ok {
+			return ""
+		}
+		resolved = filepath.Join(resolved, name)
+	}
+	return resolved
+}
+
+// taken indique si un nom se confond avec une entrée existante de son répertoire
+func (l *destListing) taken(path string) bool {
+	if l == nil {
+		return false
+	}
+	return l.existing(path) != ""
+}
+
+// renamedPath ajoute un numéro au nom d'un fichier, avant son extension
+func renamedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	if ext == path || ext == filepath.Base(path) {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// nameClaims mémorise les noms attribués à la destination, d'abord par le contrôle
+// préalable pour les fichiers de la liste, puis au fil de la copie pour les fichiers
+// trouvés dans ses répertoires
+type nameClaims struct {
+	mode    string
+	listing *destListing
+	mu      sync.Mutex
+	names   map[string]string // fichier de la liste -> nom à la destination
+	claimed map[string]string // clé de collision -> fichier de la liste
+}
+
+// newNameClaims retourne nil lorsque le contrôle des collisions est désactivé
+func newNameClaims(config *Config) *nameClaims {
+	if config.CollisionMode == "" {
+		return nil
+	}
+	c := &nameClaims{mode: config.CollisionMode, names: make(map[string]string), claimed: make(map[string]string)}
+	// Une archive ou un index de contenus n'a pas d'arborescence existante à consulter
+	if archiveFormat(config.DestDir) == "" && config.CASMode != CASIndex {
+		c.listing = &destListing{root: config.DestDir, dirs: make(map[string]map[string]string)}
+	}
+	return c
+}
+
+// lookup retourne le nom déjà attribué à un fichier
+func (c *nameClaims) lookup(file string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[file]
+	return name, ok
+}
+
+// claim réserve le nom prévu pour un fichier. En cas de collision avec le nom d'un autre
+// fichier ou une entrée existante de la destination, conflict la décrit et le nom retourné
+// est numéroté en mode rename, vide dans les autres modes.
+func (c *nameClaims) claim(file, planned string) (name, conflict string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[file]; ok {
+		return name, ""
+	}
+
+	owner, inList := c.claimed[collisionKey(planned)]
+	existing := ""
+	if c.listing != nil {
+		if existing = c.listing.existing(planned); existing == planned {
+			// Même nom exactement: le fichier existant est comparé et remplacé normalement
+			existing = ""
+		}
+	}
+	if !inList && existing == "" {
+		c.claimed[collisionKey(planned)] = file
+		c.names[file] = planned
+		return planned, ""
+	}
+
+	if inList {
+		conflict = fmt.Sprintf("%s et %s se confondent à la destination", owner, file)
+	} else {
+		conflict = fmt.Sprintf("%s se confond avec %s existant à la destination", file, existing)
+	}
+	if c.mode != CollisionRename {
+		return "", conflict
+	}
+	renamed := planned
+	for n := 2; ; n++ {
+		renamed = renamedPath(planned, n)
+		if _, used := c.claimed[collisionKey(renamed)]; !used && !c.listing.taken(renamed) {
+			break
+		}
+	}
+	c.claimed[collisionKey(renamed)] = file
+	c.names[file] = renamed
+	return renamed, conflict
+}
+
+// preflightCollisions détecte, avant la copie, les fichiers de la liste dont les noms à la
+// destination ne diffèrent que par la casse ou la normalisation Unicode, entre eux ou avec
+// le contenu existant de la destination. Il retourne les noms à utiliser à la destination,
+// complétés pendant la copie pour les fichiers trouvés dans les répertoires de la liste, ou
+// une erreur si des collisions doivent arrêter la copie.
+func preflightCollisions(files []string, config *Config, logger *log.Logger) (*nameClaims, error) {
+	claims := newNameClaims(config)
+	if claims == nil {
+		return nil, nil
+	}
+
+	collisions := 0
+	for _, file := range files {
+		file = filepath.Clean(file)
+		planned := listedDest(file, config)
+		if config.sanitizer != nil {
+			sanitized, err := config.sanitizer.sanitize(planned)
+			if err != nil {
+				// Refusé par le worker avec son motif
+				continue
+			}
+			planned = sanitized
+		}
+		if config.CollisionMode == CollisionNFC {
+			planned = norm.NFC.String(planned)
+		}
+		if _, conflict := claims.claim(file, planned); conflict != "" {
+			collisions++
+			logger.Printf("Collision de noms: %s\n", conflict)
+		}
+	}
+
+	logger.Printf("Contrôle des collisions de noms: %d fichiers, %d collisions (mode %s)\n", len(files), collisions, config.CollisionMode)
+	if collisions > 0 && config.CollisionMode != CollisionRename {
+		return nil, fmt.Errorf("%d collisions de noms détectées à la destination, copie annulée (voir le journal)", collisions)
+	}
+	return claims, nil
+}
+
+// destinationName retourne le chemin relatif à utiliser à la destination pour un fichier
+// de la liste, tel qu'établi par le contrôle des collisions ou par l'adaptation des noms.
+// Un fichier trouvé dans un répertoire de la liste est contrôlé à son tour: en collision,
+// il est renommé en mode rename et refusé dans les autres modes.
+func destinationName(id int, file string, config *Config, logger *log.Logger) (string, error) {
+	name, ok := config.claims.lookup(filepath.Clean(file))
+	if !ok {
+		// Destination définie par la liste CSV
+		target := listedDest(file, config)
+		if target != filepath.Clean(file) {
+			logger.Printf("Worker %d: Destination de %s définie par la liste: %s\n", id, file, target)
+		}
+		// Fichier hors du contrôle préalable, trouvé dans un répertoire de la liste
+		name, err := config.sanitizer.apply(id, target, logger)
+		if err != nil || config.claims == nil {
+			return name, err
+		}
+		if config.CollisionMode == CollisionNFC && !norm.NFC.IsNormalString(name) {
+			logger.Printf("Worker %d: Nom adapté pour la destination: %s -> %s\n", id, file, norm.NFC.String(name))
+			name = norm.NFC.String(name)
+		}
+		claimed, conflict := config.claims.claim(filepath.Clean(file), name)
+		if conflict == "" {
+			return claimed, nil
+		}
+		if claimed == "" {
+			return "", fmt.Errorf("%w: collision de noms, %s", ErrCopyRefused, conflict)
+		}
+		logger.Printf("Worker %d: Collision de noms: %s, copié sous %s\n", id, conflict, claimed)
+		return claimed, nil
+	}
+	if name != filepath.Clean(file) {
+		logger.Printf("Worker %d: Nom adapté pour la destination: %s -> %s\n", id, file, name)
+	}
+	return name, nil
+}
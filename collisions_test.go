@@ -0,0 +1,219 @@
+// collisions_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupCollisions crée une source avec des noms qui ne diffèrent que par la casse ou la
+// normalisation, et une destination contenant déjà une variante
+func setupCollisions(t *testing.T) (string, []string) {
+	dir, err := os.MkdirTemp("", "collisions")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	files := []string{"Beyonc\u00e9.flac", "Beyonce\u0301.flac", "Album/Piste.flac", "album/piste.flac", "notes.txt", "Readme.md"}
+	for _, file := range files {
+		path := filepath.Join(dir, "source", file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(file), 0644)
+	}
+	os.MkdirAll(filepath.Join(dir, "dest"), 0755)
+	os.WriteFile(filepath.Join(dir, "dest", "README.md"), []byte("existant"), 0644)
+	return dir, files
+}
+
+func TestCopyFiles_CollisionAbort(t *testing.T) {
+	dir, files := setupCollisions(t)
+	defer os.RemoveAll(dir)
+
+	config := &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CollisionMode: CollisionAbort}
+	err := CopyFiles(context.Background(), config, files, InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "3 collisions") {
+		t.Fatalf("Une erreur signalant 3 collisions était attendue, obtenue: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "notes.txt")); !os.IsNotExist(err) {
+		t.Errorf("Aucun fichier ne doit être copié lorsque des collisions sont détectées")
+	}
+}
+
+func TestCopyFiles_CollisionRename(t *testing.T) {
+	dir, files := setupCollisions(t)
+	defer os.RemoveAll(dir)
+
+	config := &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CollisionMode: CollisionRename}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	expected := map[string]string{
+		"Beyonc\u00e9.flac":      "Beyonc\u00e9.flac",
+		"Beyonce\u0301 (2).flac": "Beyonce\u0301.flac",
+		"Album/Piste.flac":       "Album/Piste.flac",
+		"album/piste (2).flac":   "album/piste.flac",
+		"notes.txt":              "notes.txt",
+		"Readme (2).md":          "Readme.md",
+		"README.md":              "existant",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("Contenu de %s incorrect: %q, %v", name, string(content), err)
+		}
+	}
+}
+
+func TestCopyFiles_CollisionNFC(t *testing.T) {
+	dir, err := os.MkdirTemp("", "collisions")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(filepath.Join(sourceDir, "Sigur Ro\u0301s"), 0755)
+	files := []string{"Sigur Ro\u0301s/A\u0301gaetis.flac"}
+	os.WriteFile(filepath.Join(sourceDir, files[0]), []byte("flac"), 0644)
+
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 1, CollisionMode: CollisionNFC}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "Sigur R\u00f3s", "\u00c1gaetis.flac")); err != nil {
+		t.Errorf("Le fichier doit être écrit sous son nom NFC: %v", err)
+	}
+
+	// Une seconde exécution retrouve les mêmes noms sans collision
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Errorf("Erreur inattendue lors de la seconde exécution: %v", err)
+	}
+}
+
+// setupWalkedCollisions crée un répertoire dont les fichiers, trouvés pendant la copie, se
+// confondent entre eux ou avec la destination existante
+func setupWalkedCollisions(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "collisions")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	for _, file := range []string{"album/Piste.flac", "album/piste.flac", "album/Notes.txt", "album/pochette.jpg"} {
+		path := filepath.Join(dir, "source", file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(file), 0644)
+	}
+	os.MkdirAll(filepath.Join(dir, "dest", "album"), 0755)
+	os.WriteFile(filepath.Join(dir, "dest", "album", "NOTES.txt"), []byte("existant"), 0644)
+	return dir
+}
+
+func TestCopyFiles_CollisionAbortWalked(t *testing.T) {
+	dir := setupWalkedCollisions(t)
+	defer os.RemoveAll(dir)
+
+	config := &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CollisionMode: CollisionAbort}
+	if err := CopyFiles(context.Background(), config, []string{"album"}, InitTestLogger()); err == nil {
+		t.Fatalf("Une erreur était attendue pour les collisions trouvées pendant le parcours")
+	}
+	// Un seul des deux fichiers en collision est copié, l'existant n'est pas remplacé
+	entries, _ := os.ReadDir(filepath.Join(config.DestDir, "album"))
+	if len(entries) != 3 {
+		t.Errorf("3 fichiers attendus à la destination, obtenu %d", len(entries))
+	}
+	if content, _ := os.ReadFile(filepath.Join(config.DestDir, "album", "NOTES.txt")); string(content) != "existant" {
+		t.Errorf("Le fichier existant ne doit pas être remplacé: %q", content)
+	}
+}
+
+func TestCopyFiles_CollisionRenameWalked(t *testing.T) {
+	dir := setupWalkedCollisions(t)
+	defer os.RemoveAll(dir)
+
+	config := &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 1, CollisionMode: CollisionRename}
+	if err := CopyFiles(context.Background(), config, []string{"album"}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	expected := map[string]string{
+		"album/Piste.flac":     "album/Piste.flac",
+		"album/piste (2).flac": "album/piste.flac",
+		"album/Notes (2).txt":  "album/Notes.txt",
+		"album/NOTES.txt":      "existant",
+		"album/pochette.jpg":   "album/pochette.jpg",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("Contenu de %s incorrect: %q, %v", name, string(content), err)
+		}
+	}
+}
+
+func TestCopyFiles_CollisionWithoutList(t *testing.T) {
+	dir := setupWalkedCollisions(t)
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "source", "Readme.md"), []byte("Readme.md"), 0644)
+	os.WriteFile(filepath.Join(dir, "dest", "README.md"), []byte("existant"), 0644)
+
+	// Sans liste, toute l'arborescence de la source est contrôlée au fil du parcours
+	config := &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 1, CollisionMode: CollisionRename}
+	if err := CopyFiles(context.Background(), config, []string{"."}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	expected := map[string]string{
+		"Readme (2).md":        "Readme.md",
+		"README.md":            "existant",
+		"album/Piste.flac":     "album/Piste.flac",
+		"album/piste (2).flac": "album/piste.flac",
+		"album/Notes (2).txt":  "album/Notes.txt",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("Contenu de %s incorrect: %q, %v", name, string(content), err)
+		}
+	}
+
+	// En mode abort, les fichiers en collision sont refusés
+	os.RemoveAll(config.DestDir)
+	os.MkdirAll(config.DestDir, 0755)
+	os.WriteFile(filepath.Join(config.DestDir, "README.md"), []byte("existant"), 0644)
+	config = &Config{SourceDir: filepath.Join(dir, "source"), DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CollisionMode: CollisionAbort}
+	if err := CopyFiles(context.Background(), config, []string{"."}, InitTestLogger()); err == nil {
+		t.Errorf("Une erreur était attendue pour les collisions trouvées sans liste")
+	}
+	if content, _ := os.ReadFile(filepath.Join(config.DestDir, "README.md")); string(content) != "existant" {
+		t.Errorf("Le fichier existant ne doit pas être remplacé: %q", content)
+	}
+}
+
+func TestNormalizeCollisionMode(t *testing.T) {
+	if mode, err := normalizeCollisionMode("Normalise"); err != nil || mode != CollisionNFC {
+		t.Errorf("normalise doit correspondre au mode nfc: %q, %v", mode, err)
+	}
+	if _, err := normalizeCollisionMode("ignore"); err == nil {
+		t.Errorf("Une erreur était attendue pour un mode inconnu")
+	}
+}
+
+func TestCollisionKey(t *testing.T) {
+	same := [][2]string{
+		{"Beyoncé.flac", "BEYONCÉ.FLAC"},
+		{"한국.flac", "한국.flac"}, // hangeul composé et décomposé
+		{"Việt", "việt"},         // plusieurs signes combinants
+		{"Ễ", "ễ"},
+		{"Straße", "STRAẞE"}, // ß et ẞ
+		{"Σοφος", "σοφοσ"},   // sigma final
+		{"K.flac", "k.flac"}, // signe kelvin
+		{"が", "が"},          // kana
+	}
+	for _, pair := range same {
+		if collisionKey(pair[0]) != collisionKey(pair[1]) {
+			t.Errorf("%q et %q devraient se confondre", pair[0], pair[1])
+		}
+	}
+	if collisionKey("piste 1.flac") == collisionKey("piste 2.flac") {
+		t.Errorf("Des noms différents ne devraient pas se confondre")
+	}
+}
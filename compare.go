@@ -0,0 +1,104 @@
+// compare.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Politiques de comparaison utilisées lorsque le fichier de destination existe déjà
+const (
+	PolicySizeMtime = "size-mtime" // même taille et destination non antérieure à la source
+	PolicySize      = "size"       // même taille
+	PolicyChecksum  = "checksum"   // même empreinte
+	PolicyMtime     = "mtime"      // mêmes dates de modification, à la tolérance près
+	PolicyAlways    = "always"     // toujours écraser
+	PolicyNever     = "never"      // ne jamais écraser
+	PolicyNewer     = "newer"      // écraser uniquement si la source est plus récente
+)
+
+var comparePolicies = []string{PolicySizeMtime, PolicySize, PolicyChecksum, PolicyMtime, PolicyAlways, PolicyNever, PolicyNewer}
+
+// Noms alternatifs acceptés pour les politiques
+var policyAliases = map[string]string{
+	"size+mtime": PolicySizeMtime,
+	"hash":       PolicyChecksum,
+	"overwrite":  PolicyAlways,
+	"skip":       PolicyNever,
+	"if-newer":   PolicyNewer,
+}
+
+// normalizePolicy retourne le nom canonique d'une politique de comparaison
+func normalizePolicy(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", nil
+	}
+	if canonical, ok := policyAliases[name]; ok {
+		return canonical, nil
+	}
+	for _, policy := range comparePolicies {
+		if policy == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("politique de comparaison inconnue %q (disponibles: %s)", name, strings.Join(comparePolicies, ", "))
+}
+
+// effectivePolicy retourne la politique à appliquer: celle configurée, sinon une
+// comparaison par empreinte avec --verify-hash, sinon taille et date
+func effectivePolicy(config *Config) string {
+	if config.ComparePolicy != "" {
+		return config.ComparePolicy
+	}
+	if config.VerifyHash {
+		return PolicyChecksum
+	}
+	return PolicySizeMtime
+}
+
+// mtimeDelta retourne l'écart de date de modification destination - source, à la seconde près.
+// Avec IgnoreDSTOffset, un écart d'exactement une heure (à la tolérance près) est neutralisé.
+func mtimeDelta(sourceInfo, destInfo os.FileInfo, config *Config) time.Duration {
+	delta := destInfo.ModTime().Truncate(time.Second).Sub(sourceInfo.ModTime().Truncate(time.Second))
+	if config.IgnoreDSTOffset {
+		for _, offset := range []time.Duration{time.Hour, -time.Hour} {
+			if abs(delta-offset) <= config.MtimeTolerance {
+				return delta - offset
+			}
+		}
+	}
+	return delta
+}
+
+// abs retourne la valeur absolue d'une durée
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// fileView donne accès aux attributs et à l'empreinte d'un fichier, calculés à la demande
+type fileView struct {
+	stat func() (os.FileInfo, error)
+	hash func() (string, error)
+}
+
+// pathView décrit un fichier ordinaire du système de fichiers
+func pathView(path, algorithm string) fileView {
+	return fileView{
+		stat: func() (os.FileInfo, error) { return os.Stat(path) },
+		hash: func() (string, error) { return fileHash(path, algorithm) },
+	}
+}
+
+// destView décrit un fichier de destination, déchiffré si le chiffrement est activé
+func destView(path string, config *Config) fileView {
+	if config.EncryptionKey != nil {
+		return encryptedView(path, config)
+	}
+	return pathView(path, config.HashAlgorithm)
+}
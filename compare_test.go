@@ -0,0 +1,81 @@
+// compare_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalizePolicy(t *testing.T) {
+	cases := map[string]string{
+		"":           "",
+		"SIZE-MTIME": PolicySizeMtime,
+		"size+mtime": PolicySizeMtime,
+		"checksum":   PolicyChecksum,
+		"if-newer":   PolicyNewer,
+	}
+	for input, expected := range cases {
+		got, err := normalizePolicy(input)
+		if err != nil || got != expected {
+			t.Errorf("normalizePolicy(%q) attendu %q, obtenu %q (%v)", input, expected, got, err)
+		}
+	}
+	if _, err := normalizePolicy("parfois"); err == nil {
+		t.Errorf("Une erreur était attendue pour une politique inconnue")
+	}
+}
+
+func TestFilesAreEqual_Policies(t *testing.T) {
+	dir, err := os.MkdirTemp("", "policies")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Destination tronquée mais plus récente que la source
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte("contenu complet"), 0644)
+	os.WriteFile(dest, []byte("contenu"), 0644)
+	now := time.Now()
+	os.Chtimes(source, now.Add(-time.Hour), now.Add(-time.Hour))
+	os.Chtimes(dest, now, now)
+
+	cases := []struct {
+		policy   string
+		expected bool
+	}{
+		{PolicySizeMtime, false},
+		{PolicySize, false},
+		{PolicyChecksum, false},
+		{PolicyMtime, false},
+		{PolicyAlways, false},
+		{PolicyNever, true},
+		{PolicyNewer, true},
+	}
+	for _, c := range cases {
+		same, reason, err := filesAreEqual(source, dest, &Config{ComparePolicy: c.policy})
+		if err != nil {
+			t.Fatalf("Erreur inattendue pour la politique %s: %v", c.policy, err)
+		}
+		if same != c.expected {
+			t.Errorf("Politique %s: résultat attendu %v, obtenu %v (%s)", c.policy, c.expected, same, reason)
+		}
+	}
+
+	// Écart de date couvert par la tolérance
+	os.Chtimes(dest, now.Add(-time.Hour+2*time.Second), now.Add(-time.Hour+2*time.Second))
+	same, _, err := filesAreEqual(source, dest, &Config{ComparePolicy: PolicyMtime, MtimeTolerance: 2 * time.Second})
+	if err != nil || !same {
+		t.Errorf("Les dates devraient être identiques à la tolérance près (%v)", err)
+	}
+
+	// Décalage d'une heure dû à l'heure d'été sur un volume FAT
+	os.Chtimes(dest, now, now)
+	same, _, err = filesAreEqual(source, dest, &Config{ComparePolicy: PolicyMtime, IgnoreDSTOffset: true})
+	if err != nil || !same {
+		t.Errorf("Un décalage d'une heure devrait être ignoré (%v)", err)
+	}
+}
@@ -3,9 +3,11 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +18,99 @@ type Config struct {
 	FilesListPath string
 	ThreadCount   int
 	VerifyHash    bool
+	HashAlgorithm string
+	// Politique de comparaison avec une destination existante et tolérance sur les dates
+	ComparePolicy  string
+	MtimeTolerance time.Duration
+	// Mesure de la résolution des dates de la destination au démarrage, et neutralisation
+	// des décalages d'une heure (heure d'été sur les volumes FAT)
+	ProbeTimestamps bool
+	IgnoreDSTOffset bool
+	// Attributs préservés en plus du contenu et de la date de modification
+	Preserve PreserveOptions
+	// Traitement des liens symboliques de la liste
+	SymlinkMode string
+	// Méthode de copie du contenu (auto, reflink, kernel, buffered)
+	CopyMethod string
+	// Débit maximal partagé par les workers en octets par seconde (0 = illimité), et
+	// fichier relu périodiquement pour le modifier pendant la copie
+	BandwidthLimit     float64
+	BandwidthLimitFile string
+	// Taille à partir de laquelle un fichier est copié par blocs en parallèle (0 = jamais),
+	// et taille des blocs
+	ChunkThreshold int64
+	ChunkSize      int64
+	// Suppression des sources après une copie vérifiée, et dérogation permettant de les
+	// supprimer sans vérification des empreintes
+	Move           bool
+	MoveUnverified bool
+	// Transfert différentiel des fichiers modifiés: taille de bloc (0 = automatique) et part
+	// minimale du fichier à réutiliser
+	Delta           bool
+	DeltaBlockSize  int64
+	DeltaMinSavings float64
+	// Clé AES-256 de chiffrement des fichiers écrits, nil si le chiffrement est désactivé
+	EncryptionKey []byte
+	// Stockage par contenu dans DEST_DIR: "link", "index" ou "" pour une copie ordinaire
+	CASMode string
+	// Sauvegarde des fichiers remplacés: mode, répertoire de l'arborescence de sauvegarde et
+	// nombre de versions conservées par fichier (0 = illimité)
+	BackupMode string
+	BackupDir  string
+	BackupKeep int
+	// Adaptation des noms pour les destinations Windows/SMB: mode, caractère de remplacement
+	// et longueur maximale du chemin relatif
+	SanitizeMode        string
+	SanitizeReplacement string
+	SanitizeMaxPath     int
+	// Contrôle des noms qui se confondent sur une destination insensible à la casse ou à
+	// la normalisation Unicode
+	CollisionMode string
+	// Recréer à la destination les répertoires vides des entrées de type répertoire
+	EmptyDirs bool
+	// Filtres appliqués aux fichiers trouvés en parcourant un répertoire: motifs à inclure
+	// et à exclure, fichier d'exclusions au format .gitignore, tailles et dates limites
+	Include     []string
+	Exclude     []string
+	ExcludeFile string
+	MinSize     int64
+	MaxSize     int64
+	NewerThan   time.Time
+	OlderThan   time.Time
+	// Format de la liste des fichiers ("" pour le déduire de l'extension), séparateur des
+	// colonnes CSV (0 pour le détecter) et mode de guillemets
+	ListFormat    string
+	ListDelimiter rune
+	ListQuoting   string
+	// Encodage de la liste des fichiers ("" pour le détecter)
+	ListEncoding string
+
+	// Répertoires dont les dates sont restaurées en fin de copie
+	dirTimes *dirSet
+	// Premières copies des inodes source ayant plusieurs liens physiques
+	links *linkTracker
+	// Nombre de fichiers copiés par méthode
+	stats *copyStats
+	// Limiteur de débit partagé
+	limiter *rateLimiter
+	// Blocs de fichiers volumineux proposés aux workers inoccupés
+	chunkCh chan chunkJob
+	// Répertoires source dont des fichiers ont été déplacés
+	movedDirs *dirSet
+	// Sources déplacées dont la suppression attend la publication de la destination
+	pendingSources *pendingSources
+	// Rédacteur de l'archive lorsque DEST_DIR désigne une archive
+	archive *archiveWriter
+	// Archive lue lorsque SOURCE_DIR désigne une archive
+	sourceArchive *sourceArchive
+	// Stockage par contenu lorsque CASMode est défini
+	cas *casStore
+	// Adaptation des chemins de destination lorsque SanitizeMode est défini
+	sanitizer *pathSanitizer
+	// Noms à la destination établis par le contrôle des collisions, complétés pendant la copie
+	claims *nameClaims
+	// Lignes de la liste CSV, indexées par chemin source
+	listEntries map[string]*listEntry
 }
 
 func LoadConfig() (*Config, error) {
@@ -31,10 +126,50 @@ func LoadConfig() (*Config, error) {
 	destDir := os.Getenv("DEST_DIR")
 	filesListPath := os.Getenv("FILES_LIST_PATH")
 	threadCountStr := os.Getenv("THREAD_COUNT")
+	hashAlgorithm := os.Getenv("HASH_ALGORITHM")
+	comparePolicy := os.Getenv("COMPARE_POLICY")
+	mtimeToleranceStr := os.Getenv("MTIME_TOLERANCE")
+	probeTimestampsStr := os.Getenv("TIMESTAMP_PROBE")
+	ignoreDSTStr := os.Getenv("MTIME_IGNORE_DST")
+	preserveStr := os.Getenv("PRESERVE")
+	symlinkMode := os.Getenv("SYMLINK_MODE")
+	copyMethod := os.Getenv("COPY_METHOD")
+	bandwidthLimitStr := os.Getenv("BANDWIDTH_LIMIT")
+	bandwidthLimitFile := os.Getenv("BANDWIDTH_LIMIT_FILE")
+	chunkThresholdStr := os.Getenv("CHUNK_THRESHOLD")
+	chunkSizeStr := os.Getenv("CHUNK_SIZE")
+	moveStr := os.Getenv("MOVE")
+	moveUnverifiedStr := os.Getenv("MOVE_ALLOW_UNVERIFIED")
+	deltaStr := os.Getenv("DELTA")
+	deltaBlockSizeStr := os.Getenv("DELTA_BLOCK_SIZE")
+	deltaMinSavingsStr := os.Getenv("DELTA_MIN_SAVINGS")
+	encryptionKeyStr := os.Getenv("ENCRYPTION_KEY")
+	encryptionKeyFile := os.Getenv("ENCRYPTION_KEY_FILE")
+	casMode := os.Getenv("CAS")
+	backupModeStr := os.Getenv("BACKUP")
+	backupDir := os.Getenv("BACKUP_DIR")
+	backupKeepStr := os.Getenv("BACKUP_KEEP")
+	sanitizeModeStr := os.Getenv("SANITIZE")
+	sanitizeReplacement := os.Getenv("SANITIZE_REPLACEMENT")
+	sanitizeMaxPathStr := os.Getenv("SANITIZE_MAX_PATH")
+	collisionModeStr := os.Getenv("NAME_COLLISIONS")
+	emptyDirsStr := os.Getenv("EMPTY_DIRS")
+	includeStr := os.Getenv("INCLUDE")
+	excludeStr := os.Getenv("EXCLUDE")
+	excludeFile := os.Getenv("EXCLUDE_FROM")
+	minSizeStr := os.Getenv("MIN_SIZE")
+	maxSizeStr := os.Getenv("MAX_SIZE")
+	newerThanStr := os.Getenv("NEWER_THAN")
+	olderThanStr := os.Getenv("OLDER_THAN")
+	listFormatStr := os.Getenv("LIST_FORMAT")
+	listDelimiterStr := os.Getenv("LIST_DELIMITER")
+	listQuotingStr := os.Getenv("LIST_QUOTING")
+	listEncodingStr := os.Getenv("LIST_ENCODING")
 
 	// Lecture du chemin du fichier de liste à partir de la ligne de commande si présent
-	if len(os.Args) > 1 {
-		filesListPath = os.Args[1]
+	// (premier argument après les options)
+	if flag.NArg() > 0 {
+		filesListPath = flag.Arg(0)
 	}
 
 	// Valider les variables d'environnement
@@ -45,9 +180,7 @@ func LoadConfig() (*Config, error) {
 	if destDir == "" {
 		missingVars = append(missingVars, "DEST_DIR")
 	}
-	if filesListPath == "" {
-		missingVars = append(missingVars, "FILES_LIST_PATH")
-	}
+	// Sans FILES_LIST_PATH, toute l'arborescence de SOURCE_DIR est copiée
 	if threadCountStr == "" {
 		missingVars = append(missingVars, "THREAD_COUNT")
 	}
@@ -62,11 +195,252 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("THREAD_COUNT doit être un entier positif")
 	}
 
+	// Validation de l'algorithme de hash
+	hashAlgorithm, err = normalizeHashName(hashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("HASH_ALGORITHM invalide: %v", err)
+	}
+
+	// Validation de la politique de comparaison
+	comparePolicy, err = normalizePolicy(comparePolicy)
+	if err != nil {
+		return nil, fmt.Errorf("COMPARE_POLICY invalide: %v", err)
+	}
+
+	// Conversion de MTIME_TOLERANCE en durée
+	mtimeTolerance, err := parseDuration(mtimeToleranceStr)
+	if err != nil {
+		return nil, fmt.Errorf("MTIME_TOLERANCE invalide: %v", err)
+	}
+
+	// Conversion des options booléennes
+	probeTimestamps, err := parseBool(probeTimestampsStr, true)
+	if err != nil {
+		return nil, fmt.Errorf("TIMESTAMP_PROBE invalide: %v", err)
+	}
+	ignoreDST, err := parseBool(ignoreDSTStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("MTIME_IGNORE_DST invalide: %v", err)
+	}
+
+	// Attributs à préserver
+	preserve, err := parsePreserve(preserveStr)
+	if err != nil {
+		return nil, fmt.Errorf("PRESERVE invalide: %v", err)
+	}
+
+	// Validation du mode de traitement des liens symboliques
+	symlinkMode, err = normalizeSymlinkMode(symlinkMode)
+	if err != nil {
+		return nil, fmt.Errorf("SYMLINK_MODE invalide: %v", err)
+	}
+
+	// Validation de la méthode de copie
+	copyMethod, err = normalizeCopyMethod(copyMethod)
+	if err != nil {
+		return nil, fmt.Errorf("COPY_METHOD invalide: %v", err)
+	}
+
+	// Conversion de BANDWIDTH_LIMIT en octets par seconde
+	bandwidthLimit, err := parseRate(bandwidthLimitStr)
+	if err != nil {
+		return nil, fmt.Errorf("BANDWIDTH_LIMIT invalide: %v", err)
+	}
+
+	// Conversion des tailles de la copie par blocs
+	chunkThreshold, err := parseSize(chunkThresholdStr)
+	if err != nil {
+		return nil, fmt.Errorf("CHUNK_THRESHOLD invalide: %v", err)
+	}
+	chunkSize, err := parseSize(chunkSizeStr)
+	if err != nil {
+		return nil, fmt.Errorf("CHUNK_SIZE invalide: %v", err)
+	}
+
+	// Options du mode déplacement
+	move, err := parseBool(moveStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("MOVE invalide: %v", err)
+	}
+	moveUnverified, err := parseBool(moveUnverifiedStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("MOVE_ALLOW_UNVERIFIED invalide: %v", err)
+	}
+
+	// Options du transfert différentiel
+	delta, err := parseBool(deltaStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("DELTA invalide: %v", err)
+	}
+	deltaBlockSize, err := parseSize(deltaBlockSizeStr)
+	if err != nil {
+		return nil, fmt.Errorf("DELTA_BLOCK_SIZE invalide: %v", err)
+	}
+	deltaMinSavings, err := parseRatio(deltaMinSavingsStr)
+	if err != nil {
+		return nil, fmt.Errorf("DELTA_MIN_SAVINGS invalide: %v", err)
+	}
+
+	// Clé de chiffrement, depuis sa valeur ou un fichier
+	encryptionKey, err := loadKey(encryptionKeyStr, encryptionKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("ENCRYPTION_KEY invalide: %v", err)
+	}
+
+	// Stockage par contenu
+	casMode, err = normalizeCASMode(casMode)
+	if err != nil {
+		return nil, fmt.Errorf("CAS invalide: %v", err)
+	}
+
+	// Sauvegarde des fichiers remplacés
+	backupMode, err := normalizeBackupMode(backupModeStr, backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("BACKUP invalide: %v", err)
+	}
+	backupKeep := 0
+	if backupKeepStr != "" {
+		backupKeep, err = strconv.Atoi(backupKeepStr)
+		if err != nil || backupKeep < 0 {
+			return nil, fmt.Errorf("BACKUP_KEEP invalide: %q", backupKeepStr)
+		}
+	}
+
+	// Adaptation des noms pour Windows/SMB
+	sanitizeMode, err := normalizeSanitizeMode(sanitizeModeStr)
+	if err != nil {
+		return nil, fmt.Errorf("SANITIZE invalide: %v", err)
+	}
+	if sanitizeReplacement != "" {
+		if err := validateReplacement(sanitizeReplacement); err != nil {
+			return nil, fmt.Errorf("SANITIZE_REPLACEMENT invalide: %v", err)
+		}
+	}
+	sanitizeMaxPath := 0
+	if sanitizeMaxPathStr != "" {
+		sanitizeMaxPath, err = strconv.Atoi(sanitizeMaxPathStr)
+		if err != nil || sanitizeMaxPath <= 0 {
+			return nil, fmt.Errorf("SANITIZE_MAX_PATH invalide: %q", sanitizeMaxPathStr)
+		}
+	}
+
+	// Contrôle des collisions de noms
+	collisionMode, err := normalizeCollisionMode(collisionModeStr)
+	if err != nil {
+		return nil, fmt.Errorf("NAME_COLLISIONS invalide: %v", err)
+	}
+
+	// Répertoires vides
+	emptyDirs, err := parseBool(emptyDirsStr, false)
+	if err != nil {
+		return nil, fmt.Errorf("EMPTY_DIRS invalide: %v", err)
+	}
+
+	// Filtres de parcours
+	minSize, err := parseSize(minSizeStr)
+	if err != nil {
+		return nil, fmt.Errorf("MIN_SIZE invalide: %v", err)
+	}
+	maxSize, err := parseSize(maxSizeStr)
+	if err != nil {
+		return nil, fmt.Errorf("MAX_SIZE invalide: %v", err)
+	}
+	newerThan, err := parseTimeFilter(newerThanStr, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("NEWER_THAN invalide: %v", err)
+	}
+	olderThan, err := parseTimeFilter(olderThanStr, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("OLDER_THAN invalide: %v", err)
+	}
+
+	// Format de la liste
+	listFormat, err := normalizeListFormat(listFormatStr)
+	if err != nil {
+		return nil, fmt.Errorf("LIST_FORMAT invalide: %v", err)
+	}
+	listDelimiter, err := parseDelimiter(listDelimiterStr)
+	if err != nil {
+		return nil, fmt.Errorf("LIST_DELIMITER invalide: %v", err)
+	}
+	listQuoting, err := normalizeQuoting(listQuotingStr)
+	if err != nil {
+		return nil, fmt.Errorf("LIST_QUOTING invalide: %v", err)
+	}
+	listEncoding, err := normalizeListEncoding(listEncodingStr)
+	if err != nil {
+		return nil, fmt.Errorf("LIST_ENCODING invalide: %v", err)
+	}
+
 	return &Config{
-		SourceDir:     sourceDir,
-		DestDir:       destDir,
-		FilesListPath: filesListPath,
-		ThreadCount:   threadCount,
-		VerifyHash:    false, // Default value
+		SourceDir:           sourceDir,
+		DestDir:             destDir,
+		FilesListPath:       filesListPath,
+		ThreadCount:         threadCount,
+		VerifyHash:          false, // Default value
+		HashAlgorithm:       hashAlgorithm,
+		ComparePolicy:       comparePolicy,
+		MtimeTolerance:      mtimeTolerance,
+		ProbeTimestamps:     probeTimestamps,
+		IgnoreDSTOffset:     ignoreDST,
+		Preserve:            preserve,
+		SymlinkMode:         symlinkMode,
+		CopyMethod:          copyMethod,
+		BandwidthLimit:      bandwidthLimit,
+		BandwidthLimitFile:  bandwidthLimitFile,
+		ChunkThreshold:      chunkThreshold,
+		ChunkSize:           chunkSize,
+		Move:                move,
+		MoveUnverified:      moveUnverified,
+		Delta:               delta,
+		DeltaBlockSize:      deltaBlockSize,
+		DeltaMinSavings:     deltaMinSavings,
+		EncryptionKey:       encryptionKey,
+		CASMode:             casMode,
+		BackupMode:          backupMode,
+		BackupDir:           backupDir,
+		BackupKeep:          backupKeep,
+		SanitizeMode:        sanitizeMode,
+		SanitizeReplacement: sanitizeReplacement,
+		SanitizeMaxPath:     sanitizeMaxPath,
+		CollisionMode:       collisionMode,
+		EmptyDirs:           emptyDirs,
+		Include:             splitPatterns(includeStr),
+		Exclude:             splitPatterns(excludeStr),
+		ExcludeFile:         excludeFile,
+		MinSize:             minSize,
+		MaxSize:             maxSize,
+		NewerThan:           newerThan,
+		OlderThan:           olderThan,
+		ListFormat:          listFormat,
+		ListDelimiter:       listDelimiter,
+		ListQuoting:         listQuoting,
+		ListEncoding:        listEncoding,
 	}, nil
 }
+
+// parseBool convertit une valeur booléenne, avec une valeur par défaut si elle est vide
+func parseBool(value string, defaultValue bool) (bool, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseDuration accepte une durée Go ("2s", "1h") ou un nombre entier de secondes
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		value = fmt.Sprintf("%ds", seconds)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("la durée ne peut pas être négative")
+	}
+	return d, nil
+}
@@ -2,20 +2,43 @@
 package main
 
 import (
-	"crypto/md5"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 var ErrCopyIgnored = errors.New("copie ignorée")
 
-func copyFile(source string, id int, dest string, verifyHash bool, logger *log.Logger) error {
-	// Vérifier si le fichier source existe
-	sourceInfo, err := os.Stat(source)
+// ErrHashMismatch signale que la relecture de la destination ne correspond pas à la source
+var ErrHashMismatch = errors.New("empreintes différentes après copie")
+
+// Les fichiers sont d'abord écrits sous un nom temporaire caché dans le répertoire
+// de destination, puis renommés une fois complets
+const (
+	tempFilePrefix = ".gocopy-"
+	tempFileSuffix = ".tmp"
+)
+
+// tempPathFor retourne le chemin du fichier temporaire associé au fichier de destination
+func tempPathFor(dest string) string {
+	return filepath.Join(filepath.Dir(dest), tempFilePrefix+filepath.Base(dest)+tempFileSuffix)
+}
+
+// isTempFile indique si un nom de fichier correspond à un fichier temporaire de gocopy
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempFilePrefix) && strings.HasSuffix(name, tempFileSuffix) &&
+		len(name) > len(tempFilePrefix)+len(tempFileSuffix)
+}
+
+func copyFile(source string, id int, dest string, config *Config, logger *log.Logger) error {
+	// Vérifier si le fichier source existe, sans suivre un éventuel lien symbolique
+	sourceInfo, err := os.Lstat(source)
 	if err != nil {
 		return err
 	}
@@ -26,23 +49,87 @@ func copyFile(source string, id int, dest string, verifyHash bool, logger *log.L
 		return fmt.Errorf("impossible de créer les répertoires de destination: %w", err)
 	}
 
+	// Traiter les liens symboliques selon le mode configuré
+	if sourceInfo.Mode()&os.ModeSymlink != 0 {
+		switch config.SymlinkMode {
+		case SymlinkCopy:
+			return copySymlink(source, id, dest, logger)
+		case SymlinkSkip:
+			return skipCopy(id, source, "lien symbolique", logger)
+		case SymlinkRefuse:
+			return fmt.Errorf("%w: %s est un lien symbolique", ErrCopyRefused, source)
+		}
+		sourceInfo, err = os.Stat(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ignorer les fichiers spéciaux, dont la lecture pourrait bloquer le worker
+	if reason := specialFileReason(sourceInfo.Mode()); reason != "" {
+		return skipCopy(id, source, reason, logger)
+	}
+
+	// Lier les noms d'un même inode source au lieu de dupliquer le contenu
+	entry, key, owner := config.links.claim(sourceInfo, dest)
+	if entry != nil && !owner {
+		<-entry.done
+		if entry.ok {
+			err := hardLink(entry.dest, id, dest, logger)
+			if err == nil || errors.Is(err, ErrCopyIgnored) {
+				return err
+			}
+			logger.Printf("Worker %d: Lien physique impossible pour %s, copie du contenu: %v\n", id, filepath.Base(source), err)
+		}
+	}
+	err = copyRegularFile(source, sourceInfo, id, dest, config, logger)
+	if owner {
+		config.links.finish(key, entry, err == nil || errors.Is(err, ErrCopyIgnored))
+	}
+	return err
+}
+
+// skipCopy journalise une copie ignorée et retourne ErrCopyIgnored
+func skipCopy(id int, source, reason string, logger *log.Logger) error {
+	msg := fmt.Sprintf("Worker %d: Copie ignorée pour %s: %s", id, filepath.Base(source), reason)
+	logger.Println(msg)
+	fmt.Printf("\033⚠\033 %s\n", msg) // Pictogramme jaune pour signaler l'ignorance
+	return ErrCopyIgnored
+}
+
+// copyRegularFile copie le contenu et les attributs d'un fichier ordinaire
+func copyRegularFile(source string, sourceInfo os.FileInfo, id int, dest string, config *Config, logger *log.Logger) error {
 	// Vérifier si le fichier de destination existe
-	_, err = os.Stat(dest)
+	destInfo, err := os.Stat(dest)
 	if err == nil {
-		// Comparer les hashs des fichiers pour déterminer s'ils sont identiques
-		same, err := filesAreEqual(source, dest, verifyHash)
+		// Comparer les fichiers selon la politique configurée
+		same, reason, err := filesAreEqual(source, dest, config)
 		if err != nil {
 			return err
 		}
 		if same {
-			// Log et affichage en cas de copie ignorée
-			msg := fmt.Sprintf("Worker %d: Copie ignorée pour %s: fichiers identiques", id, filepath.Base(source))
-			logger.Println(msg)
-			fmt.Printf("\033⚠\033 %s\n", msg) // Pictogramme jaune pour signaler l'ignorance
-			return ErrCopyIgnored
+			return skipCopy(id, source, fmt.Sprintf("politique %s, %s", effectivePolicy(config), reason), logger)
 		}
 	}
 
+	// Chiffrer le contenu écrit à la destination
+	if config.EncryptionKey != nil {
+		return copyEncrypted(source, sourceInfo, id, dest, config, logger)
+	}
+
+	// Ne transmettre que les blocs modifiés d'une version différente déjà présente
+	if config.Delta && destInfo != nil && destInfo.Mode().IsRegular() {
+		done, err := copyDelta(source, sourceInfo, id, dest, destInfo, config, logger)
+		if err != nil || done {
+			return err
+		}
+	}
+
+	// Répartir la copie des fichiers volumineux entre les workers disponibles
+	if config.ChunkThreshold > 0 && sourceInfo.Size() >= config.ChunkThreshold {
+		return copyChunked(source, sourceInfo, id, dest, config, logger)
+	}
+
 	// Ouvrir le fichier source en lecture
 	sourceFile, err := os.Open(source)
 	if err != nil {
@@ -50,65 +137,252 @@ func copyFile(source string, id int, dest string, verifyHash bool, logger *log.L
 	}
 	defer sourceFile.Close()
 
-	// Créer le fichier de destination en écriture
-	destFile, err := os.Create(dest)
+	// Reprendre une copie partielle précédente si son début correspond à la source
+	// Avec les sauvegardes, une destination plus courte est une ancienne version à conserver
+	// et non une copie partielle
+	tempPath := tempPathFor(dest)
+	partialDest := dest
+	if config.BackupMode != "" {
+		partialDest = ""
+	}
+	offset, err := resumeOffset(sourceFile, tempPath, partialDest, sourceInfo.Size())
 	if err != nil {
-		return fmt.Errorf("impossible de créer le fichier de destination: %w", err)
+		return err
+	}
+	if offset > 0 {
+		logger.Printf("Worker %d: Reprise de la copie de %s à l'octet %d/%d\n", id, filepath.Base(source), offset, sourceInfo.Size())
 	}
-	defer destFile.Close()
 
-	// Copier le contenu du fichier source vers le fichier de destination
-	_, err = io.Copy(destFile, sourceFile)
+	// Ouvrir le fichier temporaire en écriture, la destination finale n'est jamais partielle
+	destFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
-		return fmt.Errorf("erreur lors de la copie: %w", err)
+		return fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	committed, resumable := false, false
+	defer func() {
+		// Le fichier temporaire n'est conservé pour une reprise qu'après une copie
+		// interrompue: les autres échecs se reproduiraient sur la même copie
+		if !committed {
+			destFile.Close()
+			if !resumable {
+				os.Remove(tempPath)
+			}
+		}
+	}()
+
+	// Tronquer le fichier temporaire après la partie vérifiée et se positionner à la reprise
+	if err := destFile.Truncate(offset); err != nil {
+		return fmt.Errorf("impossible de tronquer le fichier temporaire: %w", err)
+	}
+	if _, err := destFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("impossible de se positionner dans le fichier temporaire: %w", err)
+	}
+	if _, err := sourceFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("impossible de se positionner dans le fichier source: %w", err)
+	}
+
+	// Calculer l'empreinte de la source pendant la copie si la vérification est activée
+	var sourceHasher hash.Hash
+	if config.VerifyHash {
+		sourceHasher, err = newHasher(config.HashAlgorithm)
+		if err != nil {
+			return err
+		}
+		// La partie déjà copiée lors d'une reprise n'est pas relue par la copie
+		if offset > 0 {
+			if _, err := io.Copy(sourceHasher, io.NewSectionReader(sourceFile, 0, offset)); err != nil {
+				return fmt.Errorf("erreur lors du hash de la source: %w", err)
+			}
+		}
 	}
 
-	// Copier les permissions du fichier source vers le fichier de destination
-	err = os.Chmod(dest, sourceInfo.Mode())
+	// Copier le contenu du fichier source vers le fichier temporaire
+	method, err := copyData(destFile, sourceFile, offset, sourceInfo.Size()-offset, config.CopyMethod, sourceHasher, config.limiter)
 	if err != nil {
-		return fmt.Errorf("impossible de définir les permissions du fichier de destination: %w", err)
+		resumable = true
+		return fmt.Errorf("erreur lors de la copie: %w", err)
+	}
+
+	// Forcer l'écriture sur disque avant le renommage
+	if err := destFile.Sync(); err != nil {
+		return fmt.Errorf("impossible de synchroniser le fichier temporaire: %w", err)
+	}
+	if err := destFile.Close(); err != nil {
+		return fmt.Errorf("impossible de fermer le fichier temporaire: %w", err)
 	}
 
-	// Copier les dates d'accès et de modification du fichier source vers le fichier de destination
-	err = os.Chtimes(dest, sourceInfo.ModTime(), sourceInfo.ModTime())
+	// Relire la destination et la comparer à l'empreinte de la source
+	if sourceHasher != nil {
+		sourceDigest := fmt.Sprintf("%x", sourceHasher.Sum(nil))
+		if err := verifyCopy(tempPath, sourceDigest, config.HashAlgorithm); err != nil {
+			return err
+		}
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), formatDigest(config.HashAlgorithm, sourceDigest))
+		// Les octets copiés sont ceux dont l'empreinte est comparée à la liste CSV
+		if err := checkCopiedDigest(id, source, sourceDigest, config, logger); err != nil {
+			return err
+		}
+	}
+
+	// Appliquer les attributs et renommer le fichier temporaire sur le nom final
+	if err := commitTempFile(tempPath, source, sourceInfo, id, dest, config, logger); err != nil {
+		return err
+	}
+	committed = true
+
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s)\n", id, filepath.Base(source), method)
+	config.stats.add(method, sourceInfo.Size()-offset)
+	config.limiter.count(sourceInfo.Size() - offset)
+
+	return nil
+}
+
+// commitTempFile applique les attributs de la source sur le fichier temporaire complet puis
+// le renomme sur le nom final
+func commitTempFile(tempPath, source string, sourceInfo os.FileInfo, id int, dest string, config *Config, logger *log.Logger) error {
+	// Préserver les attributs demandés, un échec est signalé sans faire échouer la copie
+	for _, failure := range preserveMetadata(tempPath, source, sourceInfo, config.Preserve) {
+		logger.Printf("Worker %d: Attribut non préservé pour %s: %v\n", id, filepath.Base(source), failure)
+	}
+
+	// Copier les dates d'accès et de modification du fichier source vers le fichier temporaire
+	atime, mtime := destinationTimes(sourceInfo, config.Preserve)
+	err := os.Chtimes(tempPath, atime, mtime)
 	if err != nil {
 		return fmt.Errorf("impossible de définir les dates du fichier de destination: %w", err)
 	}
 
+	// Conserver la version remplacée si les sauvegardes sont activées
+	if config.BackupMode != "" {
+		if err := backupDestination(id, dest, config, logger); err != nil {
+			return err
+		}
+	}
+
+	// Renommer le fichier temporaire sur le nom final
+	if err := os.Rename(tempPath, dest); err != nil {
+		return fmt.Errorf("impossible de renommer le fichier temporaire: %w", err)
+	}
 	return nil
 }
 
-func filesAreEqual(file1, file2 string, verifyHash bool) (bool, error) {
-	// Comparer les tailles des fichiers pour déterminer s'ils sont identiques
-	if !verifyHash {
-		info1, _ := os.Stat(file1)
-		info2, _ := os.Stat(file2)
-		if info2.ModTime().Unix() >= info1.ModTime().Unix() {
-			return true, nil
+// cleanupTempFiles supprime les fichiers temporaires laissés par une exécution interrompue,
+// sauf ceux qui correspondent à un fichier de la liste et pourront être repris
+func cleanupTempFiles(destDir string, files []string, logger *log.Logger) error {
+	if _, err := os.Stat(destDir); os.IsNotExist(err) {
+		return nil
+	}
+	resumable := make(map[string]bool, len(files))
+	for _, file := range files {
+		resumable[filepath.Join(destDir, file)] = true
+	}
+	return filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isTempFile(d.Name()) {
+			return nil
 		}
-		return false, nil
+		// Fichier de la liste ou situé sous un répertoire de la liste
+		name := strings.TrimSuffix(strings.TrimPrefix(d.Name(), tempFilePrefix), tempFileSuffix)
+		for target := filepath.Join(filepath.Dir(path), name); len(target) >= len(destDir); target = filepath.Dir(target) {
+			if resumable[target] {
+				return nil
+			}
+			if target == filepath.Dir(target) {
+				break
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("impossible de supprimer le fichier temporaire %s: %w", path, err)
+		}
+		logger.Printf("Fichier temporaire obsolète supprimé: %s\n", path)
+		return nil
+	})
+}
+
+// verifyCopy relit le fichier écrit et compare son empreinte à celle de la source
+func verifyCopy(path, sourceDigest, algorithm string) error {
+	destDigest, err := fileHash(path, algorithm)
+	if err != nil {
+		return fmt.Errorf("erreur lors de la relecture de la destination: %w", err)
+	}
+	if destDigest != sourceDigest {
+		return fmt.Errorf("%w: source %s, destination %s", ErrHashMismatch,
+			formatDigest(algorithm, sourceDigest), formatDigest(algorithm, destDigest))
+	}
+	return nil
+}
+
+// filesAreEqual indique si la copie peut être ignorée selon la politique de comparaison,
+// et pourquoi
+func filesAreEqual(file1, file2 string, config *Config) (bool, string, error) {
+	return compareFiles(pathView(file1, config.HashAlgorithm), destView(file2, config), config)
+}
+
+// compareFiles applique la politique de comparaison à une source et une destination dont
+// les attributs et empreintes ne sont calculés que si la politique en a besoin
+func compareFiles(source, dest fileView, config *Config) (bool, string, error) {
+	policy := effectivePolicy(config)
+	switch policy {
+	case PolicyAlways:
+		return false, "", nil
+	case PolicyNever:
+		return true, "la destination existe déjà", nil
+	case PolicyChecksum:
+		hash1, err := source.hash()
+		if err != nil {
+			return false, "", err
+		}
+		hash2, err := dest.hash()
+		if err != nil {
+			return false, "", err
+		}
+		return hash1 == hash2, fmt.Sprintf("empreintes identiques (%s)", formatDigest(config.HashAlgorithm, hash1)), nil
 	}
-	//test hash
-	hash1, err := fileHash(file1)
+
+	info1, err := source.stat()
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
-	hash2, err := fileHash(file2)
+	info2, err := dest.stat()
 	if err != nil {
-		return false, err
+		return false, "", err
+	}
+	delta := mtimeDelta(info1, info2, config)
+	tolerance := config.MtimeTolerance
+
+	switch policy {
+	case PolicySize:
+		return info1.Size() == info2.Size(), fmt.Sprintf("même taille (%d octets)", info1.Size()), nil
+	case PolicyMtime:
+		return abs(delta) <= tolerance, fmt.Sprintf("dates de modification identiques (écart %v, tolérance %v)", delta, tolerance), nil
+	case PolicyNewer:
+		return delta >= -tolerance, fmt.Sprintf("source non plus récente que la destination (écart %v)", delta), nil
+	case PolicySizeMtime:
+		same := info1.Size() == info2.Size() && delta >= -tolerance
+		return same, fmt.Sprintf("même taille (%d octets) et destination non antérieure à la source (écart %v)", info1.Size(), delta), nil
 	}
-	return hash1 == hash2, nil
+	return false, "", fmt.Errorf("politique de comparaison inconnue %q", policy)
 }
 
-func fileHash(filePath string) (string, error) {
+func fileHash(filePath string, algorithm string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hasher := md5.New()
-	if _, err := io.Copy(hasher, file); err != nil {
+	return readerHash(file, algorithm)
+}
+
+// readerHash calcule l'empreinte d'un flux
+func readerHash(r io.Reader, algorithm string) (string, error) {
+	hasher, err := newHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(hasher, r); err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
@@ -3,10 +3,13 @@ package main
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -31,7 +34,7 @@ func TestCopyFile_Success(t *testing.T) {
 
 	logger := InitTestLogger()
 
-	err = copyFile(sourceFile.Name(), 1, destFile.Name(), false, logger)
+	err = copyFile(sourceFile.Name(), 1, destFile.Name(), &Config{}, logger)
 	if err != nil {
 		t.Errorf("Erreur inattendue lors de la copie: %v", err)
 	}
@@ -56,7 +59,7 @@ func TestCopyFile_SourceNotExist(t *testing.T) {
 
 	logger := InitTestLogger()
 
-	err = copyFile("fichier_inexistant.txt", 1, destFile.Name(), false, logger)
+	err = copyFile("fichier_inexistant.txt", 1, destFile.Name(), &Config{}, logger)
 	if err == nil {
 		t.Errorf("Une erreur était attendue pour un fichier source inexistant")
 	}
@@ -86,7 +89,7 @@ func TestCopyFile_CopyIgnored(t *testing.T) {
 
 	logger := InitTestLogger()
 
-	err = copyFile(sourceFile.Name(), 1, destFile.Name(), false, logger)
+	err = copyFile(sourceFile.Name(), 1, destFile.Name(), &Config{}, logger)
 	if err != ErrCopyIgnored {
 		t.Errorf("Erreur attendue ErrCopyIgnored, obtenue: %v", err)
 	}
@@ -114,7 +117,7 @@ func TestFilesAreEqual(t *testing.T) {
 		t.Fatalf("Erreur lors de l'écriture du fichier 2: %v", err)
 	}
 
-	equal, err := filesAreEqual(file1.Name(), file2.Name(), false)
+	equal, _, err := filesAreEqual(file1.Name(), file2.Name(), &Config{})
 	if err != nil {
 		t.Fatalf("Erreur inattendue: %v", err)
 	}
@@ -128,7 +131,7 @@ func TestFilesAreEqual(t *testing.T) {
 		t.Fatalf("Erreur lors de la modification du fichier 2: %v", err)
 	}
 
-	equal, err = filesAreEqual(file1.Name(), file2.Name(), false)
+	equal, _, err = filesAreEqual(file1.Name(), file2.Name(), &Config{})
 	if err != nil {
 		t.Fatalf("Erreur inattendue: %v", err)
 	}
@@ -150,7 +153,7 @@ func TestFileHash(t *testing.T) {
 		t.Fatalf("Erreur lors de l'écriture du fichier: %v", err)
 	}
 
-	hash, err := fileHash(file.Name())
+	hash, err := fileHash(file.Name(), "md5")
 	if err != nil {
 		t.Fatalf("Erreur lors du calcul du hash: %v", err)
 	}
@@ -162,6 +165,131 @@ func TestFileHash(t *testing.T) {
 	}
 }
 
+func TestCopyFile_AtomicWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "atomic")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.txt")
+	if err := os.WriteFile(source, []byte("Contenu atomique"), 0644); err != nil {
+		t.Fatalf("Erreur lors de l'écriture du fichier source: %v", err)
+	}
+	dest := filepath.Join(dir, "out", "dest.txt")
+
+	if err := copyFile(source, 1, dest, &Config{}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+
+	// Le fichier temporaire ne doit plus exister après le renommage
+	if _, err := os.Stat(tempPathFor(dest)); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire %s ne devrait plus exister", tempPathFor(dest))
+	}
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Erreur lors de la lecture du fichier destination: %v", err)
+	}
+	if string(content) != "Contenu atomique" {
+		t.Errorf("Contenu du fichier destination incorrect: %q", string(content))
+	}
+}
+
+func TestCleanupTempFiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cleanup")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stale := tempPathFor(filepath.Join(dir, "sub", "fichier.flac"))
+	kept := filepath.Join(dir, "sub", "fichier.flac")
+	resumable := tempPathFor(filepath.Join(dir, "sub", "liste.flac"))
+	os.MkdirAll(filepath.Dir(stale), 0755)
+	os.WriteFile(stale, []byte("partiel"), 0644)
+	os.WriteFile(kept, []byte("complet"), 0644)
+	os.WriteFile(resumable, []byte("partiel"), 0644)
+
+	if err := cleanupTempFiles(dir, []string{"sub/liste.flac"}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors du nettoyage: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire obsolète aurait dû être supprimé")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("Le fichier de destination ne doit pas être supprimé: %v", err)
+	}
+	if _, err := os.Stat(resumable); err != nil {
+		t.Errorf("Le fichier temporaire d'un fichier de la liste doit être conservé: %v", err)
+	}
+}
+
+func TestCopyFile_VerifyHash(t *testing.T) {
+	dir, err := os.MkdirTemp("", "verify")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("Contenu vérifié ", 1000)
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte(content), 0644)
+	// Copie partielle pour vérifier que l'empreinte couvre aussi la partie reprise
+	os.WriteFile(tempPathFor(dest), []byte(content[:100]), 0644)
+
+	config := &Config{VerifyHash: true, HashAlgorithm: "sha256"}
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie vérifiée: %v", err)
+	}
+	copied, _ := os.ReadFile(dest)
+	if string(copied) != content {
+		t.Errorf("Contenu du fichier destination incorrect")
+	}
+}
+
+func TestCopyFile_FailureRemovesTemp(t *testing.T) {
+	dir, err := os.MkdirTemp("", "failure")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte(strings.Repeat("Nouvelle version ", 1000)), 0644)
+	os.WriteFile(dest, []byte("Ancienne version"), 0644)
+	// Sauvegarde impossible: le répertoire de sauvegarde est un fichier
+	blocker := filepath.Join(dir, "sauvegardes")
+	os.WriteFile(blocker, nil, 0644)
+
+	config := &Config{DestDir: dir, BackupMode: BackupModeDir, BackupDir: blocker}
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err == nil {
+		t.Fatalf("Une erreur était attendue pour une sauvegarde impossible")
+	}
+	// Une copie complète mais non validée ne peut pas être reprise
+	if _, err := os.Stat(tempPathFor(dest)); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire %s ne devrait plus exister", tempPathFor(dest))
+	}
+}
+
+func TestVerifyCopy_Mismatch(t *testing.T) {
+	file, err := os.CreateTemp("", "file")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du fichier temporaire: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("Contenu écrit")
+
+	if err := verifyCopy(file.Name(), computeMD5("Contenu écrit"), "md5"); err != nil {
+		t.Errorf("Erreur inattendue pour des empreintes identiques: %v", err)
+	}
+	err = verifyCopy(file.Name(), computeMD5("Contenu source"), "md5")
+	if !errors.Is(err, ErrHashMismatch) {
+		t.Errorf("Erreur attendue ErrHashMismatch, obtenue: %v", err)
+	}
+}
+
 // Fonction auxiliaire pour initialiser un logger pour les tests
 func InitTestLogger() *log.Logger {
 	return log.New(io.Discard, "", log.LstdFlags)
@@ -0,0 +1,154 @@
+// copyengine.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Méthodes de copie sélectionnables avec --copy-method
+const (
+	CopyAuto     = "auto"     // reflink, puis copie noyau, puis copie tamponnée
+	CopyReflink  = "reflink"  // clonage instantané (btrfs, XFS)
+	CopyKernel   = "kernel"   // copy_file_range puis sendfile
+	CopyBuffered = "buffered" // copie en espace utilisateur
+)
+
+var copyMethods = []string{CopyAuto, CopyReflink, CopyKernel, CopyBuffered}
+
+// Méthodes effectivement utilisées, rapportées dans le log et le résumé
+const (
+	usedReflink       = "reflink"
+	usedCopyFileRange = "copy_file_range"
+	usedSendfile      = "sendfile"
+	usedBuffered      = "buffered"
+)
+
+// errMethodUnsupported signale une méthode indisponible pour ce couple de fichiers
+var errMethodUnsupported = errors.New("méthode de copie non supportée")
+
+// normalizeCopyMethod valide la méthode de copie
+func normalizeCopyMethod(method string) (string, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	if method == "" {
+		return CopyAuto, nil
+	}
+	for _, m := range copyMethods {
+		if m == method {
+			return method, nil
+		}
+	}
+	return "", fmt.Errorf("méthode de copie inconnue %q (disponibles: %s)", method, strings.Join(copyMethods, ", "))
+}
+
+// copyData copie length octets de src vers dst à partir de offset (les deux fichiers étant
+// déjà positionnés) et retourne la méthode utilisée. Si hasher est fourni il reçoit le
+// contenu copié: en mode auto la copie tamponnée est alors utilisée pour ne lire la source
+// qu'une fois, sinon la plage copiée est relue après la copie. Seule la copie tamponnée
+// est soumise au limiteur de débit: elle remplace toute autre méthode, même imposée,
+// lorsqu'une limite est active.
+func copyData(dst, src *os.File, offset, length int64, method string, hasher hash.Hash, limiter *rateLimiter) (string, error) {
+	if method == "" {
+		method = CopyAuto
+	}
+	if (method == CopyAuto && hasher != nil) || limiter.limit() > 0 {
+		method = CopyBuffered
+	}
+
+	var attempts []func() (string, error)
+	reflink := func() (string, error) { return usedReflink, reflinkFile(dst, src) }
+	kernel := func() (string, error) { return kernelCopy(dst, src, offset, length) }
+	buffered := func() (string, error) { return usedBuffered, bufferedCopy(dst, src, hasher, limiter) }
+	switch method {
+	case CopyAuto:
+		if offset == 0 {
+			attempts = append(attempts, reflink)
+		}
+		attempts = append(attempts, kernel, buffered)
+	case CopyReflink:
+		attempts = append(attempts, reflink)
+	case CopyKernel:
+		attempts = append(attempts, kernel)
+	case CopyBuffered:
+		attempts = append(attempts, buffered)
+	}
+
+	for _, attempt := range attempts {
+		used, err := attempt()
+		if errors.Is(err, errMethodUnsupported) {
+			continue
+		}
+		if err != nil {
+			return used, err
+		}
+		// Les méthodes noyau ne passent pas par l'espace utilisateur: relire la plage copiée
+		if hasher != nil && used != usedBuffered {
+			if _, err := io.Copy(hasher, io.NewSectionReader(src, offset, length)); err != nil {
+				return used, fmt.Errorf("erreur lors du hash de la source: %w", err)
+			}
+		}
+		return used, nil
+	}
+	return "", fmt.Errorf("%w: %s indisponible pour %s", ErrCopyRefused, method, dst.Name())
+}
+
+// bufferedCopy copie en espace utilisateur. Les types sont masqués pour empêcher io.Copy
+// d'utiliser les optimisations noyau de *os.File.
+func bufferedCopy(dst, src *os.File, hasher hash.Hash, limiter *rateLimiter) error {
+	var reader io.Reader = struct{ io.Reader }{src}
+	if hasher != nil {
+		reader = io.TeeReader(src, hasher)
+	}
+	var writer io.Writer = struct{ io.Writer }{dst}
+	if limiter != nil {
+		writer = throttledWriter{w: dst, limiter: limiter}
+	}
+	_, err := io.Copy(writer, reader)
+	return err
+}
+
+// copyStats compte les fichiers et octets copiés par méthode pour le résumé final
+type copyStats struct {
+	mu    sync.Mutex
+	files map[string]int
+	bytes map[string]int64
+}
+
+func newCopyStats() *copyStats {
+	return &copyStats{files: make(map[string]int), bytes: make(map[string]int64)}
+}
+
+// add enregistre une copie effectuée avec la méthode donnée
+func (s *copyStats) add(method string, size int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[method]++
+	s.bytes[method] += size
+}
+
+// report journalise le nombre de fichiers et d'octets copiés par méthode
+func (s *copyStats) report(logger *log.Logger) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make([]string, 0, len(s.files))
+	for method := range s.files {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		logger.Printf("Méthode %s: %d fichier(s), %d octets\n", method, s.files[method], s.bytes[method])
+	}
+}
@@ -0,0 +1,140 @@
+// copyengine_linux.go
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Numéro de l'appel système copy_file_range selon l'architecture (0 si inconnu)
+func copyFileRangeTrap() uintptr {
+	switch runtime.GOARCH {
+	case "amd64":
+		return 326
+	case "386":
+		return 377
+	case "arm":
+		return 391
+	case "arm64", "riscv64", "loong64":
+		return 285
+	case "ppc64", "ppc64le":
+		return 379
+	case "s390x":
+		return 375
+	}
+	return 0
+}
+
+// Requête ioctl FICLONE (_IOW(0x94, 9, int)), dont le bit de direction varie selon l'architecture
+func ficloneRequest() uintptr {
+	switch runtime.GOARCH {
+	case "ppc64", "ppc64le", "mips", "mipsle", "mips64", "mips64le":
+		return 0x80049409
+	}
+	return 0x40049409
+}
+
+// Taille maximale transférée par appel noyau
+const kernelChunk = 1 << 30
+
+// isUnsupported indique si une erreur noyau signifie que la méthode n'est pas disponible
+// pour ce couple de fichiers (systèmes de fichiers différents, type non géré...)
+func isUnsupported(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EBADF)
+}
+
+// reflinkFile clone le contenu complet de src dans dst (FICLONE)
+func reflinkFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficloneRequest(), src.Fd())
+	if errno != 0 {
+		if isUnsupported(errno) {
+			return errMethodUnsupported
+		}
+		return errno
+	}
+	// Positionner dst en fin de fichier comme après une copie classique
+	_, err := dst.Seek(0, io.SeekEnd)
+	return err
+}
+
+// kernelCopy copie avec copy_file_range, puis sendfile si indisponible
+func kernelCopy(dst, src *os.File, offset, length int64) (string, error) {
+	err := copyFileRange(dst, src, offset, length)
+	if err == nil {
+		return usedCopyFileRange, nil
+	}
+	if !errors.Is(err, errMethodUnsupported) {
+		return usedCopyFileRange, err
+	}
+	return usedSendfile, sendfile(dst, src, offset, length)
+}
+
+// copyFileRange copie length octets dans le noyau, sans passer par l'espace utilisateur
+func copyFileRange(dst, src *os.File, offset, length int64) error {
+	if err := copyFileRangeAt(dst, src, offset, offset, length); err != nil {
+		return err
+	}
+	_, err := dst.Seek(offset+length, io.SeekStart)
+	return err
+}
+
+// copyFileRangeAt copie la plage [srcOff, srcOff+length) de src à la position dstOff de dst
+// avec copy_file_range, sans modifier la position des fichiers. Sur un partage SMB3 ou
+// NFS 4.2 la copie est effectuée par le serveur.
+func copyFileRangeAt(dst, src *os.File, srcOff, dstOff, length int64) error {
+	trap := copyFileRangeTrap()
+	if trap == 0 {
+		return errMethodUnsupported
+	}
+	for copied := int64(0); copied < length; {
+		chunk := length - copied
+		if chunk > kernelChunk {
+			chunk = kernelChunk
+		}
+		n, _, errno := syscall.Syscall6(trap, src.Fd(), uintptr(unsafe.Pointer(&srcOff)),
+			dst.Fd(), uintptr(unsafe.Pointer(&dstOff)), uintptr(chunk), 0)
+		if errno != 0 {
+			// Une méthode indisponible n'est détectée qu'au premier appel
+			if copied == 0 && isUnsupported(errno) {
+				return errMethodUnsupported
+			}
+			return errno
+		}
+		if n == 0 {
+			return errors.New("fin de fichier source inattendue")
+		}
+		copied += int64(n)
+	}
+	return nil
+}
+
+// sendfile copie length octets avec sendfile, la destination étant positionnée à offset
+func sendfile(dst, src *os.File, offset, length int64) error {
+	srcOff := offset
+	for copied := int64(0); copied < length; {
+		chunk := length - copied
+		if chunk > kernelChunk {
+			chunk = kernelChunk
+		}
+		n, err := syscall.Sendfile(int(dst.Fd()), int(src.Fd()), &srcOff, int(chunk))
+		if err != nil {
+			if copied == 0 && isUnsupported(err) {
+				return errMethodUnsupported
+			}
+			return err
+		}
+		if n == 0 {
+			return errors.New("fin de fichier source inattendue")
+		}
+		copied += int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// copyengine_other.go
+//go:build !linux
+
+package main
+
+import "os"
+
+// reflinkFile n'est pris en charge que sous Linux
+func reflinkFile(dst, src *os.File) error {
+	return errMethodUnsupported
+}
+
+// kernelCopy n'est pris en charge que sous Linux
+func kernelCopy(dst, src *os.File, offset, length int64) (string, error) {
+	return "", errMethodUnsupported
+}
+
+// copyFileRangeAt n'est pris en charge que sous Linux
+func copyFileRangeAt(dst, src *os.File, srcOff, dstOff, length int64) error {
+	return errMethodUnsupported
+}
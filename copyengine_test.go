@@ -0,0 +1,114 @@
+// copyengine_test.go
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyData_Methods(t *testing.T) {
+	dir, err := os.MkdirTemp("", "engine")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("gocopy engine ", 5000)
+	source := filepath.Join(dir, "source.bin")
+	os.WriteFile(source, []byte(content), 0644)
+	expectedDigest := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	for _, method := range []string{CopyAuto, CopyKernel, CopyBuffered, CopyReflink} {
+		src, err := os.Open(source)
+		if err != nil {
+			t.Fatalf("Erreur lors de l'ouverture de la source: %v", err)
+		}
+		destPath := filepath.Join(dir, method+".bin")
+		dst, err := os.Create(destPath)
+		if err != nil {
+			t.Fatalf("Erreur lors de la création de la destination: %v", err)
+		}
+
+		// Reprise à mi-fichier, sauf pour le clonage qui copie le fichier entier
+		offset := int64(len(content) / 2)
+		if method == CopyReflink {
+			offset = 0
+		}
+		dst.WriteString(content[:offset])
+		src.Seek(offset, io.SeekStart)
+		hasher := sha256.New()
+		hasher.Write([]byte(content[:offset]))
+
+		used, err := copyData(dst, src, offset, int64(len(content))-offset, method, hasher, nil)
+		src.Close()
+		dst.Close()
+		if method == CopyReflink && errors.Is(err, ErrCopyRefused) {
+			continue // clonage non supporté par le système de fichiers de test
+		}
+		if err != nil {
+			t.Fatalf("Erreur inattendue avec la méthode %s: %v", method, err)
+		}
+		if used == "" {
+			t.Errorf("La méthode utilisée devrait être rapportée pour %s", method)
+		}
+
+		copied, _ := os.ReadFile(destPath)
+		if string(copied) != content {
+			t.Errorf("Contenu incorrect avec la méthode %s (%s)", method, used)
+		}
+		if digest := fmt.Sprintf("%x", hasher.Sum(nil)); digest != expectedDigest {
+			t.Errorf("Empreinte incorrecte avec la méthode %s (%s)", method, used)
+		}
+	}
+}
+
+func TestNormalizeCopyMethod(t *testing.T) {
+	if method, err := normalizeCopyMethod(""); err != nil || method != CopyAuto {
+		t.Errorf("Méthode par défaut attendue auto, obtenue %q (%v)", method, err)
+	}
+	if _, err := normalizeCopyMethod("teleport"); err == nil {
+		t.Errorf("Une erreur était attendue pour une méthode inconnue")
+	}
+}
+
+func TestCopyData_LimitForcesBuffered(t *testing.T) {
+	dir, err := os.MkdirTemp("", "engine")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("x", 40*1024)
+	source := filepath.Join(dir, "source.bin")
+	os.WriteFile(source, []byte(content), 0644)
+
+	for _, method := range []string{CopyKernel, CopyReflink} {
+		src, _ := os.Open(source)
+		dst, err := os.Create(filepath.Join(dir, method+".bin"))
+		if err != nil {
+			t.Fatalf("Erreur lors de la création de la destination: %v", err)
+		}
+		// Une limite de 200 Ko/s impose environ 200 ms pour 40 Ko
+		start := time.Now()
+		used, err := copyData(dst, src, 0, int64(len(content)), method, nil, newRateLimiter(200*1024))
+		elapsed := time.Since(start)
+		src.Close()
+		dst.Close()
+		if err != nil {
+			t.Fatalf("Erreur inattendue avec la méthode %s: %v", method, err)
+		}
+		if used != usedBuffered {
+			t.Errorf("Méthode %s avec limite: copie tamponnée attendue, obtenue %s", method, used)
+		}
+		if elapsed < 150*time.Millisecond {
+			t.Errorf("Méthode %s: copie trop rapide pour la limite: %v", method, elapsed)
+		}
+	}
+}
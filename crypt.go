@@ -0,0 +1,555 @@
+// crypt.go
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Format des fichiers chiffrés: un en-tête puis le contenu découpé en blocs chiffrés et
+// authentifiés séparément (AES-256-GCM), pour vérifier et déchiffrer en flux.
+//
+//	"GCENC" | version (1) | taille de bloc (4) | nonce (12) | taille du clair (8) |
+//	longueur du nom d'algorithme (1) | algorithme | longueur de l'empreinte (1) | empreinte chiffrée
+//
+// Le nonce de chaque bloc est le nonce du fichier combiné au rang du bloc. Les données
+// authentifiées de chaque bloc reprennent l'en-tête jusqu'à l'algorithme et indiquent le
+// dernier bloc, ce qui détecte un fichier tronqué ou des blocs permutés. L'empreinte du
+// clair, calculée pendant le chiffrement, est elle-même chiffrée et authentifiée avec
+// l'en-tête: elle ne peut pas être modifiée sans la clé et ne révèle rien du contenu. Elle
+// est vérifiée au déchiffrement.
+const (
+	encryptMagic     = "GCENC"
+	encryptVersion   = 2
+	encryptKeySize   = 32
+	encryptChunkSize = 1024 * 1024
+)
+
+// Rang réservé au nonce de l'empreinte, qu'aucun bloc ne peut atteindre
+const digestChunkIndex = math.MaxUint64
+
+// Méthode rapportée pour les fichiers chiffrés
+const usedEncrypted = "encrypted"
+
+// ErrNotEncrypted signale un fichier qui n'a pas été chiffré par gocopy
+var ErrNotEncrypted = errors.New("fichier non chiffré par gocopy")
+
+// parseKey décode une clé AES-256 écrite en hexadécimal ou en base64
+func parseKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	key, err := hex.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("clé illisible, hexadécimal ou base64 attendu")
+	}
+	if len(key) != encryptKeySize {
+		return nil, fmt.Errorf("clé de %d octets, %d attendus", len(key), encryptKeySize)
+	}
+	return key, nil
+}
+
+// loadKey charge la clé depuis sa valeur ou depuis un fichier contenant soit les 32 octets
+// bruts, soit leur forme hexadécimale ou base64. Retourne nil si aucune clé n'est fournie.
+func loadKey(value, file string) ([]byte, error) {
+	if value != "" {
+		return parseKey(value)
+	}
+	if file == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lire le fichier de clé: %w", err)
+	}
+	if len(data) == encryptKeySize {
+		return data, nil
+	}
+	return parseKey(string(data))
+}
+
+// encryptedHeader est l'en-tête d'un fichier chiffré
+type encryptedHeader struct {
+	chunkSize uint32
+	nonce     [12]byte
+	size      uint64
+	algorithm string
+	sealed    []byte // empreinte chiffrée, telle qu'enregistrée
+	digest    []byte // empreinte du clair, connue une fois authentifiée par openDigest
+}
+
+// authenticated retourne la partie de l'en-tête authentifiée avec chaque bloc et avec
+// l'empreinte
+func (h *encryptedHeader) authenticated() []byte {
+	buf := make([]byte, 0, len(encryptMagic)+1+4+len(h.nonce)+8+1+len(h.algorithm))
+	buf = append(buf, encryptMagic...)
+	buf = append(buf, encryptVersion)
+	buf = binary.BigEndian.AppendUint32(buf, h.chunkSize)
+	buf = append(buf, h.nonce[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, h.size)
+	buf = append(buf, byte(len(h.algorithm)))
+	return append(buf, h.algorithm...)
+}
+
+// marshal retourne l'en-tête complet
+func (h *encryptedHeader) marshal() []byte {
+	buf := h.authenticated()
+	buf = append(buf, byte(len(h.sealed)))
+	return append(buf, h.sealed...)
+}
+
+// sealDigest chiffre l'empreinte du clair pour l'enregistrer dans l'en-tête
+func (h *encryptedHeader) sealDigest(aead cipher.AEAD, digest []byte) {
+	h.digest = digest
+	h.sealed = aead.Seal(nil, h.chunkNonce(digestChunkIndex), digest, h.authenticated())
+}
+
+// openDigest authentifie et déchiffre l'empreinte du clair enregistrée dans l'en-tête
+func (h *encryptedHeader) openDigest(aead cipher.AEAD) error {
+	digest, err := aead.Open(nil, h.chunkNonce(digestChunkIndex), h.sealed, h.authenticated())
+	if err != nil {
+		return fmt.Errorf("empreinte de l'en-tête non authentifiée, clé incorrecte ou fichier altéré")
+	}
+	h.digest = digest
+	return nil
+}
+
+// readEncryptedHeader lit l'en-tête d'un fichier chiffré
+func readEncryptedHeader(r io.Reader) (*encryptedHeader, error) {
+	fixed := make([]byte, len(encryptMagic)+1+4+12+8+1)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, ErrNotEncrypted
+	}
+	if string(fixed[:len(encryptMagic)]) != encryptMagic {
+		return nil, ErrNotEncrypted
+	}
+	fixed = fixed[len(encryptMagic):]
+	if fixed[0] != encryptVersion {
+		return nil, fmt.Errorf("version de chiffrement %d non prise en charge", fixed[0])
+	}
+	h := &encryptedHeader{chunkSize: binary.BigEndian.Uint32(fixed[1:5])}
+	copy(h.nonce[:], fixed[5:17])
+	h.size = binary.BigEndian.Uint64(fixed[17:25])
+	if h.chunkSize == 0 {
+		return nil, fmt.Errorf("en-tête de chiffrement invalide")
+	}
+
+	algorithm := make([]byte, fixed[25])
+	if _, err := io.ReadFull(r, algorithm); err != nil {
+		return nil, fmt.Errorf("en-tête de chiffrement tronqué: %w", err)
+	}
+	h.algorithm = string(algorithm)
+	var digestLen [1]byte
+	if _, err := io.ReadFull(r, digestLen[:]); err != nil {
+		return nil, fmt.Errorf("en-tête de chiffrement tronqué: %w", err)
+	}
+	h.sealed = make([]byte, digestLen[0])
+	if _, err := io.ReadFull(r, h.sealed); err != nil {
+		return nil, fmt.Errorf("en-tête de chiffrement tronqué: %w", err)
+	}
+	return h, nil
+}
+
+// chunkCount retourne le nombre de blocs, au moins un pour un fichier vide
+func (h *encryptedHeader) chunkCount() uint64 {
+	return max(1, (h.size+uint64(h.chunkSize)-1)/uint64(h.chunkSize))
+}
+
+// chunkNonce combine le nonce du fichier et le rang du bloc
+func (h *encryptedHeader) chunkNonce(index uint64) []byte {
+	nonce := h.nonce
+	binary.BigEndian.PutUint64(nonce[4:], binary.BigEndian.Uint64(nonce[4:])^index)
+	return nonce[:]
+}
+
+// chunkData retourne les données authentifiées d'un bloc
+func (h *encryptedHeader) chunkData(final bool) []byte {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+	return append(h.authenticated(), flag)
+}
+
+// newAEAD prépare le chiffrement AES-256-GCM
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptStream chiffre size octets de src dans dst, positionné en début de fichier, et
+// retourne l'en-tête avec l'empreinte du clair, réécrite en tête une fois connue
+func encryptStream(dst *os.File, src io.Reader, size int64, key []byte, algorithm string, limiter *rateLimiter) (*encryptedHeader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := newHasher(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := &encryptedHeader{chunkSize: encryptChunkSize, size: uint64(size), algorithm: algorithm, sealed: make([]byte, hasher.Size()+aead.Overhead())}
+	if _, err := rand.Read(h.nonce[:]); err != nil {
+		return nil, err
+	}
+
+	var writer io.Writer = dst
+	if limiter != nil {
+		writer = throttledWriter{w: dst, limiter: limiter}
+	}
+	if _, err := writer.Write(h.marshal()); err != nil {
+		return nil, err
+	}
+	plain := make([]byte, h.chunkSize)
+	sealed := make([]byte, 0, int(h.chunkSize)+aead.Overhead())
+	remaining := h.size
+	for index, count := uint64(0), h.chunkCount(); index < count; index++ {
+		n := min(remaining, uint64(h.chunkSize))
+		if _, err := io.ReadFull(src, plain[:n]); err != nil {
+			return nil, fmt.Errorf("erreur lors de la lecture de la source: %w", err)
+		}
+		hasher.Write(plain[:n])
+		sealed = aead.Seal(sealed[:0], h.chunkNonce(index), plain[:n], h.chunkData(index == count-1))
+		if _, err := writer.Write(sealed); err != nil {
+			return nil, err
+		}
+		remaining -= n
+	}
+
+	h.sealDigest(aead, hasher.Sum(nil))
+	if _, err := dst.WriteAt(h.marshal(), 0); err != nil {
+		return nil, fmt.Errorf("impossible d'écrire l'en-tête de chiffrement: %w", err)
+	}
+	return h, nil
+}
+
+// decryptStream déchiffre src dans dst en authentifiant chaque bloc, puis vérifie
+// l'empreinte du clair enregistrée dans l'en-tête
+func decryptStream(dst io.Writer, src io.Reader, key []byte) (*encryptedHeader, error) {
+	h, err := readEncryptedHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.openDigest(aead); err != nil {
+		return nil, err
+	}
+	hasher, err := newHasher(h.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, int(h.chunkSize)+aead.Overhead())
+	var plain []byte
+	remaining := h.size
+	for index, count := uint64(0), h.chunkCount(); index < count; index++ {
+		n := min(remaining, uint64(h.chunkSize)) + uint64(aead.Overhead())
+		if _, err := io.ReadFull(src, sealed[:n]); err != nil {
+			return nil, fmt.Errorf("fichier chiffré tronqué au bloc %d: %w", index, err)
+		}
+		plain, err = aead.Open(plain[:0], h.chunkNonce(index), sealed[:n], h.chunkData(index == count-1))
+		if err != nil {
+			return nil, fmt.Errorf("bloc %d non authentifié, clé incorrecte ou fichier altéré", index)
+		}
+		hasher.Write(plain)
+		if _, err := dst.Write(plain); err != nil {
+			return nil, err
+		}
+		remaining -= uint64(len(plain))
+	}
+	if n, _ := src.Read(sealed[:1]); n > 0 {
+		return nil, fmt.Errorf("données inattendues après le dernier bloc chiffré")
+	}
+
+	if digest := hasher.Sum(nil); !bytes.Equal(digest, h.digest) {
+		return nil, fmt.Errorf("%w: en-tête %s, contenu déchiffré %s", ErrHashMismatch,
+			formatDigest(h.algorithm, hex.EncodeToString(h.digest)), formatDigest(h.algorithm, hex.EncodeToString(digest)))
+	}
+	return h, nil
+}
+
+// plainInfo présente un fichier chiffré avec la taille de son contenu en clair
+type plainInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i plainInfo) Size() int64 {
+	return i.size
+}
+
+// encryptedView décrit un fichier de destination chiffré par son contenu en clair: taille
+// et empreinte sont lues dans l'en-tête, l'empreinte après authentification par la clé. Un fichier non chiffré est vu comme différent.
+func encryptedView(path string, config *Config) fileView {
+	header := func() (*encryptedHeader, os.FileInfo, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		h, err := readEncryptedHeader(file)
+		return h, info, err
+	}
+	return fileView{
+		stat: func() (os.FileInfo, error) {
+			h, info, err := header()
+			if errors.Is(err, ErrNotEncrypted) {
+				return plainInfo{info, -1}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return plainInfo{info, int64(h.size)}, nil
+		},
+		hash: func() (string, error) {
+			algorithm, err := normalizeHashName(config.HashAlgorithm)
+			if err != nil {
+				return "", err
+			}
+			h, _, err := header()
+			if errors.Is(err, ErrNotEncrypted) {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if h.algorithm == algorithm {
+				// Empreinte utilisée seulement une fois authentifiée avec la clé
+				aead, err := newAEAD(config.EncryptionKey)
+				if err != nil {
+					return "", err
+				}
+				if err := h.openDigest(aead); err != nil {
+					return "", fmt.Errorf("%s: %w", path, err)
+				}
+				return hex.EncodeToString(h.digest), nil
+			}
+			// Empreinte enregistrée avec un autre algorithme: déchiffrer pour la recalculer
+			hasher, err := newHasher(algorithm)
+			if err != nil {
+				return "", err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			defer file.Close()
+			if _, err := decryptStream(hasher, file, config.EncryptionKey); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+		},
+	}
+}
+
+// copyEncrypted chiffre la source dans le fichier temporaire puis le renomme sur la
+// destination. La vérification déchiffre le fichier écrit et contrôle chaque bloc ainsi
+// que l'empreinte du clair.
+func copyEncrypted(source string, sourceInfo os.FileInfo, id int, dest string, config *Config, logger *log.Logger) error {
+	algorithm, err := normalizeHashName(config.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	tempPath := tempPathFor(dest)
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	abort := func(err error) error {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	header, err := encryptStream(tempFile, sourceFile, sourceInfo.Size(), config.EncryptionKey, algorithm, config.limiter)
+	if err != nil {
+		return abort(fmt.Errorf("erreur lors du chiffrement: %w", err))
+	}
+	if err := tempFile.Sync(); err != nil {
+		return abort(fmt.Errorf("impossible de synchroniser le fichier temporaire: %w", err))
+	}
+	if err := tempFile.Close(); err != nil {
+		return abort(fmt.Errorf("impossible de fermer le fichier temporaire: %w", err))
+	}
+
+	digest := formatDigest(algorithm, hex.EncodeToString(header.digest))
+	if config.VerifyHash {
+		if err := verifyEncrypted(tempPath, config.EncryptionKey); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), digest)
+		if err := checkCopiedDigest(id, source, hex.EncodeToString(header.digest), config, logger); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+	}
+
+	if err := commitTempFile(tempPath, source, sourceInfo, id, dest, config, logger); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s, clair %s)\n", id, filepath.Base(source), usedEncrypted, digest)
+	config.stats.add(usedEncrypted, sourceInfo.Size())
+	config.limiter.count(sourceInfo.Size())
+	return nil
+}
+
+// verifyEncrypted relit et déchiffre un fichier chiffré pour en contrôler l'intégrité
+func verifyEncrypted(path string, key []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("erreur lors de la relecture de la destination: %w", err)
+	}
+	defer file.Close()
+	if _, err := decryptStream(io.Discard, file, key); err != nil {
+		return fmt.Errorf("erreur lors de la relecture de la destination: %w", err)
+	}
+	return nil
+}
+
+// decryptFile restaure un fichier chiffré, via un fichier temporaire, avec le mode et la
+// date du fichier chiffré
+func decryptFile(input, output string, key []byte) (*encryptedHeader, error) {
+	source, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("impossible de créer les répertoires de destination: %w", err)
+	}
+	tempPath := tempPathFor(output)
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return nil, fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	header, err := decryptStream(tempFile, source, key)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	err = errors.Join(err, tempFile.Close())
+	if err == nil {
+		err = os.Chtimes(tempPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tempPath, output)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return header, nil
+}
+
+// runDecrypt implémente la sous-commande "decrypt": restaure un fichier chiffré, ou tous
+// les fichiers chiffrés d'un répertoire en conservant l'arborescence
+func runDecrypt(args []string) error {
+	flags := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keyFile := flags.String("key-file", "", "File containing the encryption key (default ENCRYPTION_KEY or ENCRYPTION_KEY_FILE)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s decrypt [-key-file file] <encrypted file or directory> <output>\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("fichier ou répertoire chiffré et destination attendus")
+	}
+
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("erreur lors du chargement du fichier .env: %v", err)
+	}
+	key, err := loadKey(os.Getenv("ENCRYPTION_KEY"), os.Getenv("ENCRYPTION_KEY_FILE"))
+	if *keyFile != "" {
+		key, err = loadKey("", *keyFile)
+	}
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("aucune clé de chiffrement fournie")
+	}
+
+	input, output := flags.Arg(0), flags.Arg(1)
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return reportDecrypt(input, output, key)
+	}
+
+	var failed int
+	err = filepath.WalkDir(input, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isTempFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(input, path)
+		if err != nil {
+			return err
+		}
+		if err := reportDecrypt(path, filepath.Join(output, rel), key); err != nil {
+			fmt.Println(err)
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d fichiers non déchiffrés", failed)
+	}
+	return nil
+}
+
+// reportDecrypt déchiffre un fichier et affiche l'empreinte vérifiée du clair
+func reportDecrypt(input, output string, key []byte) error {
+	header, err := decryptFile(input, output, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", input, err)
+	}
+	fmt.Printf("Déchiffré: %s (%s)\n", output, formatDigest(header.algorithm, hex.EncodeToString(header.digest)))
+	return nil
+}
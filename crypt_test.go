@@ -0,0 +1,206 @@
+// crypt_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKey retourne une clé AES-256 de test
+func testKey() []byte {
+	return bytes.Repeat([]byte{0x42}, encryptKeySize)
+}
+
+func TestEncryptStream_RoundTrip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "crypt")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int{0, 1, encryptChunkSize, encryptChunkSize + 1, 3*encryptChunkSize - 7} {
+		plain := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(plain)
+
+		file, err := os.Create(filepath.Join(dir, "chiffré"))
+		if err != nil {
+			t.Fatalf("Erreur lors de la création du fichier chiffré: %v", err)
+		}
+		header, err := encryptStream(file, bytes.NewReader(plain), int64(size), testKey(), "sha256", nil)
+		file.Close()
+		if err != nil {
+			t.Fatalf("Erreur inattendue lors du chiffrement de %d octets: %v", size, err)
+		}
+
+		encrypted, _ := os.ReadFile(file.Name())
+		if size > 16 && bytes.Contains(encrypted, plain[:16]) {
+			t.Errorf("Le contenu en clair apparaît dans le fichier chiffré")
+		}
+		var out bytes.Buffer
+		decrypted, err := decryptStream(&out, bytes.NewReader(encrypted), testKey())
+		if err != nil {
+			t.Fatalf("Erreur inattendue lors du déchiffrement de %d octets: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), plain) {
+			t.Errorf("Contenu déchiffré incorrect pour %d octets", size)
+		}
+		if !bytes.Equal(decrypted.digest, header.digest) || decrypted.algorithm != "sha256" {
+			t.Errorf("Empreinte de l'en-tête incorrecte pour %d octets", size)
+		}
+	}
+}
+
+func TestDecryptStream_Tampering(t *testing.T) {
+	plain := bytes.Repeat([]byte("master flac "), encryptChunkSize/4)
+	file, err := os.CreateTemp("", "crypt")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du fichier temporaire: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := encryptStream(file, bytes.NewReader(plain), int64(len(plain)), testKey(), "md5", nil); err != nil {
+		t.Fatalf("Erreur inattendue lors du chiffrement: %v", err)
+	}
+	file.Close()
+	encrypted, _ := os.ReadFile(file.Name())
+
+	// Octet modifié, fichier tronqué à une limite de bloc, mauvaise clé, fichier en clair
+	altered := append([]byte{}, encrypted...)
+	altered[len(altered)/2] ^= 1
+	header, _ := readEncryptedHeader(bytes.NewReader(encrypted))
+	truncated := encrypted[:len(header.marshal())+encryptChunkSize+16]
+	otherKey := bytes.Repeat([]byte{0x24}, encryptKeySize)
+	// Empreinte de l'en-tête remplacée, algorithme remplacé
+	forged := append([]byte{}, encrypted...)
+	forged[len(header.marshal())-1] ^= 1
+	renamed := bytes.Replace(encrypted, []byte("md5"), []byte("sha"), 1)
+
+	cases := []struct {
+		name string
+		data []byte
+		key  []byte
+	}{
+		{"altéré", altered, testKey()},
+		{"tronqué", truncated, testKey()},
+		{"mauvaise clé", encrypted, otherKey},
+		{"en clair", plain, testKey()},
+		{"à l'empreinte modifiée", forged, testKey()},
+		{"à l'algorithme modifié", renamed, testKey()},
+	}
+	for _, c := range cases {
+		if _, err := decryptStream(&bytes.Buffer{}, bytes.NewReader(c.data), c.key); err == nil {
+			t.Errorf("Une erreur était attendue pour un fichier %s", c.name)
+		}
+	}
+	if _, err := decryptStream(&bytes.Buffer{}, bytes.NewReader(plain), testKey()); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("Erreur attendue ErrNotEncrypted, obtenue: %v", err)
+	}
+}
+
+func TestCopyFile_Encrypted(t *testing.T) {
+	dir, err := os.MkdirTemp("", "crypt")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("Contenu confidentiel ", 5000)
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest", "source.flac")
+	os.WriteFile(source, []byte(content), 0644)
+
+	config := &Config{EncryptionKey: testKey(), VerifyHash: true, HashAlgorithm: "sha256"}
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie chiffrée: %v", err)
+	}
+	encrypted, _ := os.ReadFile(dest)
+	if strings.Contains(string(encrypted), "Contenu confidentiel") {
+		t.Errorf("La destination ne devrait pas contenir le clair")
+	}
+
+	// L'empreinte du clair n'apparaît pas en clair dans l'en-tête
+	digest, _ := fileHash(source, "sha256")
+	if raw, _ := hex.DecodeString(digest); bytes.Contains(encrypted, raw) {
+		t.Errorf("L'empreinte du clair ne devrait pas apparaître dans la destination")
+	}
+
+	// La comparaison utilise l'empreinte du clair enregistrée dans l'en-tête
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != ErrCopyIgnored {
+		t.Errorf("Erreur attendue ErrCopyIgnored, obtenue: %v", err)
+	}
+	config.VerifyHash = false
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != ErrCopyIgnored {
+		t.Errorf("Erreur attendue ErrCopyIgnored selon la taille du clair, obtenue: %v", err)
+	}
+
+	// Restauration par la sous-commande de déchiffrement
+	restored := filepath.Join(dir, "restauré", "source.flac")
+	if err := runDecrypt([]string{"-key-file", writeKeyFile(t, dir), filepath.Join(dir, "dest"), filepath.Join(dir, "restauré")}); err != nil {
+		t.Fatalf("Erreur inattendue lors du déchiffrement: %v", err)
+	}
+	decrypted, _ := os.ReadFile(restored)
+	if string(decrypted) != content {
+		t.Errorf("Contenu restauré incorrect")
+	}
+}
+
+func TestEncryptedView_ForgedDigest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "crypt")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte("contenu chiffré"), 0644)
+	config := &Config{EncryptionKey: testKey(), VerifyHash: true, HashAlgorithm: "sha256"}
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie chiffrée: %v", err)
+	}
+
+	// Un en-tête recopié depuis un autre fichier chiffré avec la même clé ne s'authentifie pas
+	other := filepath.Join(dir, "autre.flac")
+	os.WriteFile(source, []byte("autre contenu"), 0644)
+	if err := copyFile(source, 1, other, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie chiffrée: %v", err)
+	}
+	encrypted, _ := os.ReadFile(dest)
+	forged, _ := os.ReadFile(other)
+	header, _ := readEncryptedHeader(bytes.NewReader(encrypted))
+	n := len(header.marshal())
+	copy(encrypted[n-len(header.sealed):n], forged[n-len(header.sealed):n])
+	os.WriteFile(dest, encrypted, 0644)
+
+	if _, err := encryptedView(dest, config).hash(); err == nil {
+		t.Errorf("Une empreinte falsifiée ne devrait pas être acceptée")
+	}
+}
+
+// writeKeyFile écrit la clé de test en hexadécimal et retourne le chemin du fichier
+func writeKeyFile(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "cle.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("42", encryptKeySize)+"\n"), 0600); err != nil {
+		t.Fatalf("Erreur lors de l'écriture du fichier de clé: %v", err)
+	}
+	return path
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := loadKey(strings.Repeat("42", encryptKeySize), "")
+	if err != nil || !bytes.Equal(key, testKey()) {
+		t.Errorf("Clé hexadécimale mal lue: %v", err)
+	}
+	if _, err := loadKey("0102", ""); err == nil {
+		t.Errorf("Une erreur était attendue pour une clé trop courte")
+	}
+	if key, err := loadKey("", ""); key != nil || err != nil {
+		t.Errorf("Aucune clé attendue sans configuration")
+	}
+}
@@ -0,0 +1,434 @@
+// csvlist.go
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Formats de la liste des fichiers
+const (
+	ListText = "text" // un chemin par ligne
+	ListCSV  = "csv"  // colonnes nommées par un en-tête
+	ListTSV  = "tsv"  // colonnes séparées par des tabulations
+)
+
+var listFormats = []string{ListText, ListCSV, ListTSV}
+
+// Guillemets des listes CSV
+const (
+	QuotingDouble = "double" // champs entre guillemets doubles, "" pour un guillemet
+	QuotingNone   = "none"   // aucun guillemet, le séparateur ne peut pas apparaître dans un champ
+)
+
+// Noms acceptés pour les colonnes de la liste, en minuscules
+var listColumns = map[string]string{
+	"source":      "source",
+	"src":         "source",
+	"path":        "source",
+	"file":        "source",
+	"dest":        "dest",
+	"destination": "dest",
+	"target":      "dest",
+	"size":        "size",
+	"priority":    "priority",
+}
+
+// listEntry décrit une ligne d'une liste CSV
+type listEntry struct {
+	line      int
+	source    string
+	dest      string      // chemin relatif à la destination, vide pour conserver celui de la source
+	size      int64       // taille attendue, -1 si non renseignée
+	algorithm string      // algorithme de l'empreinte attendue
+	digest    string      // empreinte attendue, vide si non renseignée
+	priority  int         // les lignes de priorité la plus haute sont copiées en premier
+	verified  atomic.Bool // empreinte comparée pendant la copie
+}
+
+// normalizeListFormat valide le format de la liste ("" le déduit de l'extension)
+func normalizeListFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "", ListText, ListCSV, ListTSV:
+		return format, nil
+	case "txt":
+		return ListText, nil
+	}
+	return "", fmt.Errorf("format de liste inconnu %q (disponibles: %s)", format, strings.Join(listFormats, ", "))
+}
+
+// listFormat retourne le format de la liste, déduit de son extension s'il n'est pas imposé
+func listFormat(path, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ListCSV
+	case ".tsv", ".tab":
+		return ListTSV
+	}
+	return ListText
+}
+
+// parseDelimiter valide le séparateur de colonnes ("" pour le détecter)
+func parseDelimiter(value string) (rune, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	case "semicolon":
+		return ';', nil
+	case "comma":
+		return ',', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, fmt.Errorf("séparateur invalide %q", value)
+	}
+	return r, nil
+}
+
+// normalizeQuoting valide le mode de guillemets des listes CSV
+func normalizeQuoting(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "":
+		return QuotingDouble, nil
+	case QuotingDouble, QuotingNone:
+		return value, nil
+	}
+	return "", fmt.Errorf("mode de guillemets inconnu %q (disponibles: %s, %s)", value, QuotingDouble, QuotingNone)
+}
+
+// detectDelimiter choisit le séparateur le plus fréquent de la ligne d'en-tête
+func detectDelimiter(header string) rune {
+	best, count := ',', 0
+	for _, candidate := range []rune{'\t', ';', ','} {
+		if n := strings.Count(header, string(candidate)); n > count {
+			best, count = candidate, n
+		}
+	}
+	return best
+}
+
+// recordReader lit les lignes de la liste sous forme de champs, avec leur numéro de ligne
+type recordReader func() ([]string, int, error)
+
+// newRecordReader lit les champs avec ou sans guillemets
+func newRecordReader(r *bufio.Reader, delimiter rune, quoting string) recordReader {
+	if quoting == QuotingNone {
+		line := 0
+		return func() ([]string, int, error) {
+			text, err := r.ReadString('\n')
+			if text == "" && err != nil {
+				return nil, line, err
+			}
+			line++
+			text = strings.TrimRight(text, "\r\n")
+			return strings.Split(text, string(delimiter)), line, nil
+		}
+	}
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	return func() ([]string, int, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+		line, _ := reader.FieldPos(0)
+		return record, line, nil
+	}
+}
+
+// ReadCSVList lit une liste CSV ou TSV dont la première ligne nomme les colonnes. Il
+// retourne les fichiers source par priorité décroissante et la description de chaque ligne.
+func ReadCSVList(path string, config *Config) ([]string, map[string]*listEntry, error) {
+	text, encoding, err := readListText(path, config.ListEncoding)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(strings.NewReader(text))
+	delimiter := config.ListDelimiter
+	if delimiter == 0 && listFormat(path, config.ListFormat) == ListTSV {
+		delimiter = '\t'
+	}
+	if delimiter == 0 {
+		first, _, _ := strings.Cut(text, "\n")
+		delimiter = detectDelimiter(first)
+	}
+	quoting := config.ListQuoting
+	if quoting == "" {
+		quoting = QuotingDouble
+	}
+	read := newRecordReader(reader, delimiter, quoting)
+
+	// En-tête: colonnes connues et algorithmes d'empreinte
+	header, _, err := read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("impossible de lire l'en-tête de la liste: %w", err)
+	}
+	columns := make(map[string]int)
+	var digestColumns []int
+	var algorithms []string
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if column, ok := listColumns[name]; ok {
+			columns[column] = i
+		} else if algorithm, err := normalizeHashName(name); err == nil && name != "" {
+			digestColumns = append(digestColumns, i)
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if _, ok := columns["source"]; !ok {
+		return nil, nil, fmt.Errorf("colonne source absente de l'en-tête de la liste (colonnes: %s)", strings.Join(header, ", "))
+	}
+
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []*listEntry
+	index := make(map[string]*listEntry)
+	var errs []error
+	for {
+		record, line, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("erreur lors de la lecture de la liste des fichiers: %w", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if err := checkListLine(strings.Join(record, string(delimiter)), encoding); err != nil {
+			errs = append(errs, fmt.Errorf("ligne %d: %w", line, err))
+			continue
+		}
+		entry, err := parseListEntry(record, line, field, digestColumns, algorithms)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ligne %d: %w", line, err))
+			continue
+		}
+		if previous, ok := index[entry.source]; ok {
+			errs = append(errs, fmt.Errorf("ligne %d: %s déjà listé ligne %d", line, entry.source, previous.line))
+			continue
+		}
+		index[entry.source] = entry
+		entries = append(entries, entry)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].priority > entries[j].priority })
+	files := make([]string, len(entries))
+	for i, entry := range entries {
+		files[i] = entry.source
+	}
+	return files, index, nil
+}
+
+// parseListEntry convertit une ligne de la liste
+func parseListEntry(record []string, line int, field func([]string, string) string, digestColumns []int, algorithms []string) (*listEntry, error) {
+	entry := &listEntry{line: line, size: -1}
+
+	source := field(record, "source")
+	if source == "" {
+		return nil, errors.New("chemin source vide")
+	}
+	entry.source = filepath.Clean(source)
+
+	if dest := field(record, "dest"); dest != "" {
+		dest = filepath.Clean(filepath.FromSlash(dest))
+		if filepath.IsAbs(dest) || dest == ".." || strings.HasPrefix(dest, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("destination %q hors de DEST_DIR", dest)
+		}
+		entry.dest = dest
+	}
+
+	if size := field(record, "size"); size != "" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("taille invalide %q", size)
+		}
+		entry.size = n
+	}
+
+	if priority := field(record, "priority"); priority != "" {
+		n, err := strconv.Atoi(priority)
+		if err != nil {
+			return nil, fmt.Errorf("priorité invalide %q", priority)
+		}
+		entry.priority = n
+	}
+
+	// Première empreinte renseignée, éventuellement préfixée par son algorithme
+	for i, column := range digestColumns {
+		if column >= len(record) || strings.TrimSpace(record[column]) == "" {
+			continue
+		}
+		digest := strings.ToLower(strings.TrimSpace(record[column]))
+		digest = strings.TrimPrefix(digest, algorithms[i]+":")
+		if len(digest)%2 != 0 || strings.Trim(digest, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("empreinte %s invalide %q", algorithms[i], record[column])
+		}
+		entry.algorithm, entry.digest = algorithms[i], digest
+		break
+	}
+	return entry, nil
+}
+
+// listedEntry retourne la ligne de la liste CSV d'un fichier, nil s'il n'y figure pas
+func listedEntry(file string, config *Config) *listEntry {
+	if config.listEntries == nil {
+		return nil
+	}
+	return config.listEntries[filepath.Clean(file)]
+}
+
+// listedDest retourne le chemin relatif à la destination défini par la liste CSV pour un
+// fichier, ou pour un fichier trouvé dans un répertoire listé
+func listedDest(file string, config *Config) string {
+	file = filepath.Clean(file)
+	if config.listEntries == nil {
+		return file
+	}
+	for dir := file; dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if entry, ok := config.listEntries[dir]; ok {
+			if entry.dest == "" {
+				return file
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return file
+			}
+			return filepath.Join(entry.dest, rel)
+		}
+	}
+	return file
+}
+
+// digestCheckedByCopy indique si l'empreinte attendue par la liste est comparée à celle
+// calculée pendant la copie, sans lecture supplémentaire de la source: copie vérifiée d'un
+// répertoire vers une arborescence, avec le même algorithme que la liste
+func digestCheckedByCopy(entry *listEntry, config *Config) bool {
+	if entry == nil || entry.digest == "" || !config.VerifyHash {
+		return false
+	}
+	if config.archive != nil || config.cas != nil || config.sourceArchive != nil {
+		return false
+	}
+	algorithm, err := normalizeHashName(config.HashAlgorithm)
+	return err == nil && algorithm == entry.algorithm
+}
+
+// checkListedFile vérifie, une seule fois avant la copie, la taille attendue d'un fichier
+// source de la liste CSV, ainsi que son empreinte lorsqu'elle ne peut pas être comparée
+// pendant la copie. Un écart refuse la copie sans nouvelle tentative.
+func checkListedFile(id int, file, sourcePath string, config *Config, logger *log.Logger) error {
+	entry := listedEntry(file, config)
+	if entry == nil || (entry.size < 0 && entry.digest == "") {
+		return nil
+	}
+
+	var size int64
+	if config.sourceArchive != nil {
+		archived, err := config.sourceArchive.lookup(file, true)
+		if err != nil {
+			return err
+		}
+		size = archived.info.Size()
+	} else {
+		info, err := os.Stat(sourcePath)
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+	if entry.size >= 0 && size != entry.size {
+		return fmt.Errorf("%w: %s fait %d octets, la liste en annonce %d (ligne %d)", ErrCopyRefused, file, size, entry.size, entry.line)
+	}
+	if entry.digest == "" || digestCheckedByCopy(entry, config) {
+		return nil
+	}
+	return hashListedFile(id, file, sourcePath, entry, config, logger)
+}
+
+// checkListedCopy contrôle après coup l'empreinte d'un fichier qui devait être vérifiée
+// pendant la copie mais ne l'a pas été (copie ignorée, lien physique)
+func checkListedCopy(id int, file, sourcePath string, config *Config, logger *log.Logger) error {
+	entry := listedEntry(file, config)
+	if !digestCheckedByCopy(entry, config) || entry.verified.Load() {
+		return nil
+	}
+	return hashListedFile(id, file, sourcePath, entry, config, logger)
+}
+
+// checkCopiedDigest compare l'empreinte de la source calculée pendant la copie à celle de la
+// liste CSV, avant que la destination ne soit renommée sur son nom final
+func checkCopiedDigest(id int, source, digest string, config *Config, logger *log.Logger) error {
+	if config.listEntries == nil {
+		return nil
+	}
+	file, err := filepath.Rel(config.SourceDir, source)
+	if err != nil {
+		return nil
+	}
+	entry := listedEntry(file, config)
+	if !digestCheckedByCopy(entry, config) {
+		return nil
+	}
+	if err := matchListedDigest(id, file, entry, digest, logger); err != nil {
+		return err
+	}
+	entry.verified.Store(true)
+	return nil
+}
+
+// hashListedFile calcule l'empreinte d'un fichier source et la compare à celle de la liste
+func hashListedFile(id int, file, sourcePath string, entry *listEntry, config *Config, logger *log.Logger) error {
+	var actual string
+	var err error
+	if config.sourceArchive != nil {
+		var archived *sourceEntry
+		if archived, err = config.sourceArchive.lookup(file, true); err == nil {
+			actual, err = config.sourceArchive.hash(archived, entry.algorithm)
+		}
+	} else {
+		actual, err = fileHash(sourcePath, entry.algorithm)
+	}
+	if err != nil {
+		return fmt.Errorf("erreur lors du hash de la source: %w", err)
+	}
+	return matchListedDigest(id, file, entry, actual, logger)
+}
+
+// matchListedDigest compare une empreinte de la source à celle de la liste
+func matchListedDigest(id int, file string, entry *listEntry, actual string, logger *log.Logger) error {
+	if actual != entry.digest {
+		return fmt.Errorf("%w: empreinte de %s différente de celle de la liste (ligne %d): %s, attendue %s", ErrCopyRefused,
+			file, entry.line, formatDigest(entry.algorithm, actual), formatDigest(entry.algorithm, entry.digest))
+	}
+	logger.Printf("Worker %d: Empreinte de %s conforme à la liste (%s)\n", id, file, formatDigest(entry.algorithm, actual))
+	return nil
+}
@@ -0,0 +1,179 @@
+// csvlist_test.go
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSVList(t *testing.T) {
+	dir, err := os.MkdirTemp("", "csvlist")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Export Excel français: points-virgules et guillemets autour des champs
+	path := filepath.Join(dir, "liste.csv")
+	content := "Source;Destination;Size;MD5;Priority\r\n" +
+		"album/01.flac;;12;;1\r\n" +
+		"\"album/02; live.flac\";renommé/02.flac;;D41D8CD98F00B204E9800998ECF8427E;5\r\n" +
+		"notes.txt;;;;\r\n"
+	os.WriteFile(path, []byte(content), 0644)
+
+	files, entries, err := ReadCSVList(path, &Config{})
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	expected := []string{filepath.FromSlash("album/02; live.flac"), filepath.FromSlash("album/01.flac"), "notes.txt"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Ordre attendu %v, obtenu %v", expected, files)
+	}
+	entry := entries[filepath.FromSlash("album/02; live.flac")]
+	if entry == nil || entry.dest != filepath.FromSlash("renommé/02.flac") || entry.algorithm != "md5" ||
+		entry.digest != "d41d8cd98f00b204e9800998ecf8427e" || entry.size != -1 || entry.line != 3 {
+		t.Errorf("Ligne mal lue: %+v", entry)
+	}
+	if entry := entries[filepath.FromSlash("album/01.flac")]; entry == nil || entry.size != 12 || entry.dest != "" {
+		t.Errorf("Ligne mal lue: %+v", entry)
+	}
+
+	// Les erreurs indiquent leur numéro de ligne
+	os.WriteFile(path, []byte("source,size,sha256\na.txt,douze,\nb.txt,,xyz\n../c.txt,,\na.txt,,\n"), 0644)
+	_, _, err = ReadCSVList(path, &Config{})
+	if err == nil || !strings.Contains(err.Error(), "ligne 2: taille invalide") || !strings.Contains(err.Error(), "ligne 3: empreinte sha256 invalide") {
+		t.Errorf("Erreurs par ligne attendues, obtenues: %v", err)
+	}
+	os.WriteFile(path, []byte("source\tdest\na.txt\t../../etc/passwd\n"), 0644)
+	if _, _, err = ReadCSVList(path, &Config{ListDelimiter: '\t'}); err == nil || !strings.Contains(err.Error(), "ligne 2") {
+		t.Errorf("Une destination hors de DEST_DIR doit être refusée: %v", err)
+	}
+	// Sans guillemets, un guillemet fait partie du nom
+	os.WriteFile(path, []byte("source;size\n\"live\".flac;3\n"), 0644)
+	files, _, err = ReadCSVList(path, &Config{ListQuoting: QuotingNone})
+	if err != nil || len(files) != 1 || files[0] != `"live".flac` {
+		t.Errorf("Liste sans guillemets mal lue: %v, %v", files, err)
+	}
+
+	os.WriteFile(path, []byte("fichier,taille\na.txt,1\n"), 0644)
+	if _, _, err = ReadCSVList(path, &Config{}); err == nil {
+		t.Errorf("Une erreur était attendue sans colonne source")
+	}
+}
+
+func TestCopyFiles_CSVList(t *testing.T) {
+	dir, err := os.MkdirTemp("", "csvlist")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a.flac"), []byte("contenu a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.flac"), []byte("contenu b"), 0644)
+	sum := md5.Sum([]byte("contenu a"))
+
+	listPath := filepath.Join(dir, "liste.tsv")
+	list := "source\tdest\tmd5\n" +
+		"a.flac\tlivraison/A.flac\t" + hex.EncodeToString(sum[:]) + "\n" +
+		"b.flac\t\t" + hex.EncodeToString(sum[:]) + "\n"
+	os.WriteFile(listPath, []byte(list), 0644)
+
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2}
+	files, entries, err := ReadCSVList(listPath, config)
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	config.listEntries = entries
+	err = CopyFiles(context.Background(), config, files, InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "différente de celle de la liste") {
+		t.Errorf("Une erreur d'empreinte était attendue pour b.flac, obtenue: %v", err)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(config.DestDir, "livraison", "A.flac")); err != nil || string(content) != "contenu a" {
+		t.Errorf("a.flac doit être copié sous le nom défini par la liste: %q, %v", string(content), err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "b.flac")); !os.IsNotExist(err) {
+		t.Errorf("b.flac ne doit pas être copié avec une empreinte différente de la liste")
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	for value, want := range map[string]rune{"": 0, ";": ';', "tab": '\t', `\t`: '\t', "|": '|'} {
+		if got, err := parseDelimiter(value); err != nil || got != want {
+			t.Errorf("parseDelimiter(%q) = %q, %v; attendu %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{`"`, ";;"} {
+		if _, err := parseDelimiter(value); err == nil {
+			t.Errorf("Une erreur était attendue pour le séparateur %q", value)
+		}
+	}
+	if detectDelimiter("source;dest;md5") != ';' || detectDelimiter("source,dest") != ',' || detectDelimiter("source\tdest") != '\t' {
+		t.Errorf("Séparateur mal détecté")
+	}
+}
+
+func TestCopyFiles_CSVListDigestDuringCopy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "csvlist")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	destDir := filepath.Join(dir, "dest")
+	os.MkdirAll(sourceDir, 0755)
+	os.MkdirAll(destDir, 0755)
+	for _, name := range []string{"a.flac", "b.flac", "c.flac"} {
+		os.WriteFile(filepath.Join(sourceDir, name), []byte("contenu "+name), 0644)
+	}
+	// c.flac est déjà à jour à la destination: sa copie est ignorée
+	os.WriteFile(filepath.Join(destDir, "c.flac"), []byte("contenu c.flac"), 0644)
+	sum := md5.Sum([]byte("contenu a.flac"))
+
+	listPath := filepath.Join(dir, "liste.csv")
+	list := "source,md5\n" +
+		"a.flac," + hex.EncodeToString(sum[:]) + "\n" +
+		"b.flac," + hex.EncodeToString(sum[:]) + "\n" +
+		"c.flac," + hex.EncodeToString(sum[:]) + "\n"
+	os.WriteFile(listPath, []byte(list), 0644)
+
+	config := &Config{SourceDir: sourceDir, DestDir: destDir, ThreadCount: 2, VerifyHash: true, HashAlgorithm: "md5", ComparePolicy: PolicyChecksum}
+	files, entries, err := ReadCSVList(listPath, config)
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	config.listEntries = entries
+	err = CopyFiles(context.Background(), config, files[:2], InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "b.flac différente de celle de la liste") {
+		t.Errorf("Une erreur d'empreinte était attendue pour b.flac, obtenue: %v", err)
+	}
+
+	// L'empreinte de a.flac est celle des octets copiés, sans lecture préalable de la source
+	if !entries["a.flac"].verified.Load() {
+		t.Errorf("L'empreinte de a.flac aurait dû être comparée pendant la copie")
+	}
+	if content, err := os.ReadFile(filepath.Join(destDir, "a.flac")); err != nil || string(content) != "contenu a.flac" {
+		t.Errorf("a.flac doit être copié: %q, %v", string(content), err)
+	}
+	// b.flac est refusé après la copie, avant le renommage final
+	if _, err := os.Stat(filepath.Join(destDir, "b.flac")); !os.IsNotExist(err) {
+		t.Errorf("b.flac ne doit pas être copié avec une empreinte différente de la liste")
+	}
+	if _, err := os.Stat(tempPathFor(filepath.Join(destDir, "b.flac"))); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire de b.flac doit être supprimé")
+	}
+	// c.flac, ignoré, est tout de même contrôlé
+	err = CopyFiles(context.Background(), config, files[2:], InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "c.flac différente de celle de la liste") {
+		t.Errorf("Une erreur d'empreinte était attendue pour c.flac, obtenue: %v", err)
+	}
+}
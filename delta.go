@@ -0,0 +1,358 @@
+// delta.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Bornes de la taille de bloc calculée automatiquement pour le transfert différentiel
+const (
+	minDeltaBlock = 4 * 1024
+	maxDeltaBlock = 1024 * 1024
+)
+
+// Part minimale du fichier qui doit être réutilisée pour que le transfert différentiel
+// soit préféré à une copie complète
+const defaultDeltaMinSavings = 0.5
+
+// Méthode rapportée pour les transferts différentiels
+const usedDelta = "delta"
+
+// deltaBlockSize retourne la taille de bloc configurée, ou la racine carrée de la taille du
+// fichier bornée entre 4 Kio et 1 Mio, comme rsync
+func deltaBlockSize(size, configured int64) int64 {
+	if configured > 0 {
+		return configured
+	}
+	block := int64(math.Sqrt(float64(size))) &^ 1023
+	return max(minDeltaBlock, min(block, maxDeltaBlock))
+}
+
+// parseRatio convertit un pourcentage ("50%", "50") ou une fraction ("0.5") en fraction
+func parseRatio(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	percent := strings.HasSuffix(value, "%")
+	r, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if percent || r > 1 {
+		r /= 100
+	}
+	if r < 0 || r > 1 {
+		return 0, fmt.Errorf("valeur hors de l'intervalle 0-100%%: %q", value)
+	}
+	return r, nil
+}
+
+// weakSum calcule la somme faible glissante de rsync sur un bloc
+func weakSum(block []byte) (a, b uint32) {
+	n := uint32(len(block))
+	for i, c := range block {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a, b
+}
+
+// weakKey combine les deux composantes de la somme faible, modulo 2^16 chacune
+func weakKey(a, b uint32) uint32 {
+	return a&0xffff | b<<16
+}
+
+// strongSum calcule la somme forte d'un bloc
+func strongSum(block []byte) uint64 {
+	h := newXXH64()
+	h.Write(block)
+	return h.Sum64()
+}
+
+// blockSignature décrit un bloc complet de la destination
+type blockSignature struct {
+	offset int64
+	strong uint64
+}
+
+// deltaSignature indexe les blocs de la destination par somme faible
+type deltaSignature struct {
+	blockSize int64
+	blocks    map[uint32][]blockSignature
+}
+
+// computeSignature calcule les sommes faibles et fortes de chaque bloc complet du fichier
+func computeSignature(r io.Reader, blockSize int64) (*deltaSignature, error) {
+	sig := &deltaSignature{blockSize: blockSize, blocks: make(map[uint32][]blockSignature)}
+	block := make([]byte, blockSize)
+	for offset := int64(0); ; offset += blockSize {
+		if _, err := io.ReadFull(r, block); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return sig, nil
+			}
+			return nil, err
+		}
+		key := weakKey(weakSum(block))
+		sig.blocks[key] = append(sig.blocks[key], blockSignature{offset: offset, strong: strongSum(block)})
+	}
+}
+
+// match cherche un bloc de la destination identique à la fenêtre, en privilégiant le bloc
+// situé à la même position
+func (s *deltaSignature) match(key uint32, window []byte, pos int64) (int64, bool) {
+	candidates, ok := s.blocks[key]
+	if !ok {
+		return 0, false
+	}
+	strong := strongSum(window)
+	found, offset := false, int64(0)
+	for _, c := range candidates {
+		if c.strong != strong {
+			continue
+		}
+		if c.offset == pos {
+			return c.offset, true
+		}
+		if !found {
+			found, offset = true, c.offset
+		}
+	}
+	return offset, found
+}
+
+// deltaOp est un segment de la source, soit réutilisé depuis la destination à destOff,
+// soit transmis depuis la source (destOff négatif)
+type deltaOp struct {
+	srcOff, length, destOff int64
+}
+
+// appendOp ajoute un segment en fusionnant les segments contigus de même nature
+func appendOp(ops []deltaOp, op deltaOp) []deltaOp {
+	if n := len(ops); n > 0 {
+		prev := &ops[n-1]
+		contiguous := prev.srcOff+prev.length == op.srcOff
+		if contiguous && prev.destOff < 0 && op.destOff < 0 {
+			prev.length += op.length
+			return ops
+		}
+		if contiguous && prev.destOff >= 0 && prev.destOff+prev.length == op.destOff {
+			prev.length += op.length
+			return ops
+		}
+	}
+	return append(ops, op)
+}
+
+// computeDelta parcourt la source avec la somme glissante et retourne les segments à
+// réutiliser depuis la destination ou à transmettre
+func computeDelta(r io.Reader, sig *deltaSignature) ([]deltaOp, error) {
+	blockSize := int(sig.blockSize)
+	buf := make([]byte, 0, 4*blockSize+(1<<20))
+	start, eof := 0, false
+	var pos, literalStart int64
+	var ops []deltaOp
+
+	// fill compacte le tampon et le complète depuis la source
+	fill := func() error {
+		n := copy(buf[:cap(buf)], buf[start:])
+		buf, start = buf[:n], 0
+		read, err := io.ReadFull(r, buf[n:cap(buf)])
+		buf = buf[:n+read]
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			eof = true
+			return nil
+		}
+		return err
+	}
+
+	var a, b uint32
+	valid := false
+	for {
+		if len(buf)-start <= blockSize && !eof {
+			if err := fill(); err != nil {
+				return nil, err
+			}
+		}
+		if len(buf)-start < blockSize {
+			break
+		}
+		window := buf[start : start+blockSize]
+		if !valid {
+			a, b = weakSum(window)
+			valid = true
+		}
+		if offset, ok := sig.match(weakKey(a, b), window, pos); ok {
+			if pos > literalStart {
+				ops = appendOp(ops, deltaOp{srcOff: literalStart, length: pos - literalStart, destOff: -1})
+			}
+			ops = appendOp(ops, deltaOp{srcOff: pos, length: int64(blockSize), destOff: offset})
+			pos += int64(blockSize)
+			start += blockSize
+			literalStart = pos
+			valid = false
+			continue
+		}
+		// Faire glisser la fenêtre d'un octet
+		if len(buf)-start <= blockSize {
+			break
+		}
+		out, in := uint32(buf[start]), uint32(buf[start+blockSize])
+		a = a - out + in
+		b = b - uint32(blockSize)*out + a
+		start++
+		pos++
+	}
+
+	// Le reste de la source est transmis
+	if end := pos + int64(len(buf)-start); end > literalStart {
+		ops = appendOp(ops, deltaOp{srcOff: literalStart, length: end - literalStart, destOff: -1})
+	}
+	return ops, nil
+}
+
+// literalBytes retourne le volume à transmettre depuis la source
+func literalBytes(ops []deltaOp) int64 {
+	var n int64
+	for _, op := range ops {
+		if op.destOff < 0 {
+			n += op.length
+		}
+	}
+	return n
+}
+
+// cloneDestination crée le fichier temporaire comme copie de la destination effectuée par
+// le système de fichiers ou le serveur (reflink, puis copy_file_range), sans que son contenu
+// ne transite par le client. Retourne errMethodUnsupported si aucune n'est disponible.
+func cloneDestination(tempFile, destFile *os.File, size int64) error {
+	err := reflinkFile(tempFile, destFile)
+	if !errors.Is(err, errMethodUnsupported) {
+		return err
+	}
+	return copyFileRangeAt(tempFile, destFile, 0, 0, size)
+}
+
+// copyDelta met à jour une copie de la destination existante en n'écrivant que les segments
+// modifiés de la source: la copie initiale et le déplacement des blocs décalés sont faits
+// côté serveur. Seules la lecture de la destination pour sa signature et l'écriture des
+// segments modifiés transitent par le client et sont soumises au limiteur. Retourne false
+// sans erreur lorsque la copie côté serveur est indisponible ou que le gain serait
+// insuffisant, la copie complète prenant alors le relais.
+func copyDelta(source string, sourceInfo os.FileInfo, id int, dest string, destInfo os.FileInfo, config *Config, logger *log.Logger) (bool, error) {
+	blockSize := deltaBlockSize(sourceInfo.Size(), config.DeltaBlockSize)
+	if destInfo.Size() < blockSize {
+		return false, nil
+	}
+	destFile, err := os.Open(dest)
+	if err != nil {
+		return false, err
+	}
+	defer destFile.Close()
+
+	// Copie de la destination dans le fichier temporaire, qui ne sert de base que si elle
+	// est faite côté serveur: sinon le transfert différentiel coûterait plus qu'une copie
+	tempPath := tempPathFor(dest)
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return false, fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	abort := func(err error) (bool, error) {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return false, err
+	}
+	if err := cloneDestination(tempFile, destFile, destInfo.Size()); err != nil {
+		if errors.Is(err, errMethodUnsupported) {
+			logger.Printf("Worker %d: Transfert différentiel de %s impossible sans copie côté serveur\n", id, filepath.Base(source))
+			return abort(nil)
+		}
+		return abort(fmt.Errorf("impossible de copier la destination existante: %w", err))
+	}
+
+	// Signature de la destination puis recherche des blocs communs dans la source
+	sig, err := computeSignature(throttledReader{r: io.NewSectionReader(destFile, 0, destInfo.Size()), limiter: config.limiter}, blockSize)
+	if err != nil {
+		return abort(fmt.Errorf("erreur lors de la signature de la destination: %w", err))
+	}
+	config.limiter.count(destInfo.Size())
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return abort(err)
+	}
+	defer sourceFile.Close()
+	ops, err := computeDelta(io.NewSectionReader(sourceFile, 0, sourceInfo.Size()), sig)
+	if err != nil {
+		return abort(fmt.Errorf("erreur lors de la comparaison des blocs: %w", err))
+	}
+
+	// Abandonner si la part réutilisée est insuffisante
+	literal := literalBytes(ops)
+	minSavings := config.DeltaMinSavings
+	if minSavings <= 0 {
+		minSavings = defaultDeltaMinSavings
+	}
+	if float64(sourceInfo.Size()-literal) < float64(sourceInfo.Size())*minSavings {
+		logger.Printf("Worker %d: Transfert différentiel de %s abandonné: %d octets sur %d à transmettre\n", id, filepath.Base(source), literal, sourceInfo.Size())
+		return abort(nil)
+	}
+
+	// Mettre à jour la copie sur place: les blocs restés à leur position sont déjà en place,
+	// les blocs décalés sont recopiés côté serveur depuis la destination d'origine
+	for _, op := range ops {
+		switch {
+		case op.destOff == op.srcOff:
+			continue
+		case op.destOff >= 0:
+			err = copyFileRangeAt(tempFile, destFile, op.destOff, op.srcOff, op.length)
+		default:
+			err = copyRange(tempFile, sourceFile, op.srcOff, op.length, config.limiter)
+		}
+		if err != nil {
+			return abort(fmt.Errorf("erreur lors du transfert différentiel: %w", err))
+		}
+	}
+	if err := tempFile.Truncate(sourceInfo.Size()); err != nil {
+		return abort(fmt.Errorf("impossible de dimensionner le fichier temporaire: %w", err))
+	}
+	if err := tempFile.Sync(); err != nil {
+		return abort(fmt.Errorf("impossible de synchroniser le fichier temporaire: %w", err))
+	}
+	if err := tempFile.Close(); err != nil {
+		return abort(fmt.Errorf("impossible de fermer le fichier temporaire: %w", err))
+	}
+
+	// Vérification du fichier reconstruit
+	if config.VerifyHash {
+		sourceDigest, err := fileHash(source, config.HashAlgorithm)
+		if err != nil {
+			return abort(fmt.Errorf("erreur lors du hash de la source: %w", err))
+		}
+		if err := verifyCopy(tempPath, sourceDigest, config.HashAlgorithm); err != nil {
+			return abort(err)
+		}
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), formatDigest(config.HashAlgorithm, sourceDigest))
+		if err := checkCopiedDigest(id, source, sourceDigest, config, logger); err != nil {
+			return abort(err)
+		}
+	}
+
+	if err := commitTempFile(tempPath, source, sourceInfo, id, dest, config, logger); err != nil {
+		os.Remove(tempPath)
+		return false, err
+	}
+
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s, %d octets transmis, %d réutilisés)\n",
+		id, filepath.Base(source), usedDelta, literal, sourceInfo.Size()-literal)
+	config.stats.add(usedDelta, literal)
+	config.limiter.count(literal)
+	return true, nil
+}
@@ -0,0 +1,169 @@
+// delta_test.go
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWeakSum_Rolling(t *testing.T) {
+	data := make([]byte, 64)
+	rand.New(rand.NewSource(1)).Read(data)
+	const n = 16
+
+	a, b := weakSum(data[:n])
+	for i := 1; i+n <= len(data); i++ {
+		out, in := uint32(data[i-1]), uint32(data[i+n-1])
+		a = a - out + in
+		b = b - n*out + a
+		wa, wb := weakSum(data[i : i+n])
+		if weakKey(a, b) != weakKey(wa, wb) {
+			t.Fatalf("Somme glissante incorrecte à la position %d", i)
+		}
+	}
+}
+
+func TestComputeDelta(t *testing.T) {
+	const block = 1024
+	old := make([]byte, 16*block)
+	rand.New(rand.NewSource(2)).Read(old)
+
+	// Insertion de quelques octets au milieu: les blocs suivants sont décalés
+	changed := append(append(append([]byte{}, old[:5*block]...), []byte("étiquette")...), old[5*block:]...)
+
+	sig, err := computeSignature(bytes.NewReader(old), block)
+	if err != nil {
+		t.Fatalf("Erreur inattendue lors de la signature: %v", err)
+	}
+	ops, err := computeDelta(bytes.NewReader(changed), sig)
+	if err != nil {
+		t.Fatalf("Erreur inattendue lors du calcul du delta: %v", err)
+	}
+	if literal := literalBytes(ops); literal != int64(len("étiquette")) {
+		t.Errorf("Octets à transmettre incorrects: attendu %d, obtenu %d", len("étiquette"), literal)
+	}
+
+	// Reconstruction à partir des segments
+	var rebuilt []byte
+	for _, op := range ops {
+		if op.destOff >= 0 {
+			rebuilt = append(rebuilt, old[op.destOff:op.destOff+op.length]...)
+		} else {
+			rebuilt = append(rebuilt, changed[op.srcOff:op.srcOff+op.length]...)
+		}
+	}
+	if !bytes.Equal(rebuilt, changed) {
+		t.Errorf("Le fichier reconstruit ne correspond pas à la source")
+	}
+}
+
+// requireServerSideCopy ignore le test lorsque le système de fichiers du répertoire ne
+// permet pas la copie côté serveur dont dépend le transfert différentiel
+func requireServerSideCopy(t *testing.T, dir string) {
+	t.Helper()
+	src, err := os.Create(filepath.Join(dir, "sonde-source"))
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de la sonde: %v", err)
+	}
+	defer src.Close()
+	src.Write([]byte("sonde"))
+	dst, err := os.Create(filepath.Join(dir, "sonde-copie"))
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de la sonde: %v", err)
+	}
+	defer dst.Close()
+	if err := cloneDestination(dst, src, 5); err != nil {
+		t.Skipf("Copie côté serveur indisponible: %v", err)
+	}
+}
+
+func TestCopyFile_Delta(t *testing.T) {
+	dir, err := os.MkdirTemp("", "delta")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	requireServerSideCopy(t, dir)
+
+	content := make([]byte, 256*1024)
+	rand.New(rand.NewSource(3)).Read(content)
+	cases := map[string][]byte{
+		// Seul un bloc au milieu change
+		"modification": append(append(append([]byte{}, content[:100000]...), "nouveau tag"...), content[100000+len("nouveau tag"):]...),
+		// Les blocs suivant l'insertion sont décalés
+		"insertion": append(append(append([]byte{}, content[:100000]...), "nouveau tag"...), content[100000:]...),
+	}
+	for name, modified := range cases {
+		source := filepath.Join(dir, name+".flac")
+		dest := filepath.Join(dir, "out", name+".flac")
+		os.MkdirAll(filepath.Dir(dest), 0755)
+		os.WriteFile(dest, content, 0644)
+		os.WriteFile(source, modified, 0644)
+
+		config := &Config{Delta: true, DeltaBlockSize: 4096, ComparePolicy: PolicyAlways, VerifyHash: true, HashAlgorithm: "xxh64"}
+		config.stats = newCopyStats()
+		config.limiter = newRateLimiter(0)
+		if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+			t.Fatalf("%s: erreur inattendue lors du transfert différentiel: %v", name, err)
+		}
+		copied, _ := os.ReadFile(dest)
+		if !bytes.Equal(copied, modified) {
+			t.Errorf("%s: contenu du fichier destination incorrect après transfert différentiel", name)
+		}
+		sent, ok := config.stats.bytes[usedDelta]
+		if !ok || sent == 0 || sent > 2*4096 {
+			t.Errorf("%s: volume transmis inattendu: %d octets", name, sent)
+		}
+		// Octets lus et écrits sur la destination par le client: une lecture complète pour la
+		// signature et les seuls segments modifiés, le reste étant copié côté serveur
+		if total := config.limiter.bytes(); total != int64(len(content))+sent {
+			t.Errorf("%s: octets lus et écrits sur la destination: %d, attendu %d", name, total, int64(len(content))+sent)
+		}
+	}
+}
+
+func TestCopyFile_DeltaFallback(t *testing.T) {
+	dir, err := os.MkdirTemp("", "delta")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Contenus sans aucun bloc commun: la copie complète prend le relais
+	source := filepath.Join(dir, "source.bin")
+	dest := filepath.Join(dir, "dest.bin")
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(4)).Read(content)
+	other := make([]byte, 64*1024)
+	rand.New(rand.NewSource(5)).Read(other)
+	os.WriteFile(source, content, 0644)
+	os.WriteFile(dest, other, 0644)
+
+	config := &Config{Delta: true, ComparePolicy: PolicyAlways}
+	config.stats = newCopyStats()
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	copied, _ := os.ReadFile(dest)
+	if !bytes.Equal(copied, content) {
+		t.Errorf("Contenu du fichier destination incorrect après la copie complète")
+	}
+	if _, ok := config.stats.bytes[usedDelta]; ok {
+		t.Errorf("Le transfert différentiel n'aurait pas dû être utilisé")
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+	for value, want := range map[string]float64{"50%": 0.5, "25": 0.25, "0.75": 0.75, "": 0} {
+		got, err := parseRatio(value)
+		if err != nil || got != want {
+			t.Errorf("parseRatio(%q) = %v, %v; attendu %v", value, got, err, want)
+		}
+	}
+	if _, err := parseRatio("150%"); err == nil {
+		t.Errorf("Une erreur était attendue pour une valeur hors limites")
+	}
+}
@@ -0,0 +1,478 @@
+// extract.go
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Méthode rapportée pour les fichiers extraits d'une archive source
+const usedExtract = "extract"
+
+// Nombre maximal de liens symboliques suivis pour résoudre une entrée d'archive
+const maxArchiveLinkDepth = 8
+
+// sourceEntry décrit une entrée de l'archive source
+type sourceEntry struct {
+	name    string
+	info    os.FileInfo
+	link    string    // cible d'un lien symbolique
+	ordinal int       // rang de l'entrée dans le flux tar
+	offset  int64     // début des données dans un tar non compressé
+	zf      *zip.File // entrée zip
+}
+
+// sourceArchive donne accès aux entrées d'une archive utilisée comme SOURCE_DIR, sans
+// extraction préalable. Les entrées zip et tar sont lues en parallèle; un tar compressé
+// ne se lit que séquentiellement et ses entrées sont servies une à une.
+type sourceArchive struct {
+	path    string
+	format  string
+	entries map[string]*sourceEntry
+	zr      *zip.ReadCloser
+	file    *os.File
+
+	// Flux d'un tar compressé et rang de la prochaine entrée qu'il fournira
+	mu     sync.Mutex
+	gz     *gzip.Reader
+	stream *tar.Reader
+	next   int
+}
+
+// archiveEntryName normalise un nom de la liste ou de l'archive
+func archiveEntryName(name string) string {
+	name = path.Clean(strings.TrimLeft(filepath.ToSlash(name), "/"))
+	return strings.TrimPrefix(name, "./")
+}
+
+// localEntryName normalise le nom d'une entrée de l'archive et refuse ceux qui sortiraient
+// du répertoire d'extraction ("../", volume ou nom réservé sous Windows)
+func localEntryName(name string) (string, error) {
+	cleaned := archiveEntryName(name)
+	if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("entrée %q hors du répertoire d'extraction", name)
+	}
+	return cleaned, nil
+}
+
+// openSourceArchive ouvre l'archive source et indexe ses entrées
+func openSourceArchive(archivePath string) (*sourceArchive, error) {
+	s := &sourceArchive{path: archivePath, format: archiveFormat(archivePath), entries: make(map[string]*sourceEntry)}
+	var err error
+	switch s.format {
+	case ArchiveZip:
+		err = s.indexZip()
+	case ArchiveTar, ArchiveTarGz:
+		err = s.indexTar()
+	default:
+		err = fmt.Errorf("format d'archive non reconnu: %s", archivePath)
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("impossible de lire l'archive source %s: %w", archivePath, err)
+	}
+	return s, nil
+}
+
+// indexZip indexe les entrées d'une archive zip
+func (s *sourceArchive) indexZip() error {
+	zr, err := zip.OpenReader(s.path)
+	if err != nil {
+		return err
+	}
+	s.zr = zr
+	for i, zf := range zr.File {
+		name, err := localEntryName(zf.Name)
+		if err != nil {
+			return err
+		}
+		entry := &sourceEntry{name: name, info: zf.FileInfo(), ordinal: i, zf: zf}
+		if entry.info.Mode()&os.ModeSymlink != 0 {
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			target, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			entry.link = string(target)
+		}
+		s.entries[entry.name] = entry
+	}
+	return nil
+}
+
+// indexTar parcourt le tar une fois pour indexer ses entrées. Dans un tar non compressé,
+// la position des données de chaque entrée permet ensuite de les lire en parallèle.
+func (s *sourceArchive) indexTar() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	var reader io.Reader = file
+	if s.format == ArchiveTarGz {
+		if s.gz, err = gzip.NewReader(file); err != nil {
+			return err
+		}
+		reader = s.gz
+	}
+	tr := tar.NewReader(reader)
+	for ordinal := 0; ; ordinal++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, err := localEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+		entry := &sourceEntry{name: name, info: header.FileInfo(), ordinal: ordinal}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			entry.link = header.Linkname
+		case tar.TypeLink:
+			// Un lien physique partage les données d'une entrée précédente
+			target, ok := s.entries[archiveEntryName(header.Linkname)]
+			if !ok {
+				continue
+			}
+			linked := *target
+			linked.name = entry.name
+			entry = &linked
+		case tar.TypeGNUSparse:
+			entry.info = irregularInfo{entry.info}
+		}
+		if s.format == ArchiveTar && header.Typeflag != tar.TypeLink {
+			// Le lecteur tar lit les en-têtes bloc par bloc: la position courante est le
+			// début des données
+			if entry.offset, err = file.Seek(0, io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+		s.entries[entry.name] = entry
+	}
+	if s.format == ArchiveTarGz {
+		return s.rewind()
+	}
+	return nil
+}
+
+// irregularInfo signale une entrée dont les données ne peuvent pas être lues directement
+type irregularInfo struct {
+	os.FileInfo
+}
+
+func (i irregularInfo) Mode() os.FileMode {
+	return i.FileInfo.Mode() | os.ModeIrregular
+}
+
+// rewind repositionne le flux d'un tar compressé au début de l'archive
+func (s *sourceArchive) rewind() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := s.gz.Reset(s.file); err != nil {
+		return err
+	}
+	s.stream = tar.NewReader(s.gz)
+	s.next = 0
+	return nil
+}
+
+// lookup résout un nom de la liste en entrée de l'archive, en suivant les liens
+// symboliques internes si demandé
+func (s *sourceArchive) lookup(name string, follow bool) (*sourceEntry, error) {
+	entry, ok := s.entries[archiveEntryName(name)]
+	for depth := 0; ok && follow && entry.link != ""; depth++ {
+		if depth == maxArchiveLinkDepth {
+			return nil, fmt.Errorf("trop de liens symboliques pour %s dans l'archive", name)
+		}
+		entry, ok = s.entries[archiveEntryName(path.Join(path.Dir(entry.name), entry.link))]
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: filepath.Join(s.path, name), Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// open retourne le contenu d'une entrée. Pour un tar compressé, le flux est réservé
+// jusqu'à la fermeture du lecteur retourné.
+func (s *sourceArchive) open(entry *sourceEntry) (io.ReadCloser, error) {
+	switch s.format {
+	case ArchiveZip:
+		return entry.zf.Open()
+	case ArchiveTar:
+		return io.NopCloser(io.NewSectionReader(s.file, entry.offset, entry.info.Size())), nil
+	}
+
+	s.mu.Lock()
+	// Revenir au début si l'entrée est déjà passée dans le flux
+	if entry.ordinal < s.next {
+		if err := s.rewind(); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	for s.next <= entry.ordinal {
+		if _, err := s.stream.Next(); err != nil {
+			s.rewind()
+			s.mu.Unlock()
+			return nil, fmt.Errorf("entrée %s introuvable dans le flux de l'archive: %w", entry.name, err)
+		}
+		s.next++
+	}
+	return &streamEntry{Reader: io.LimitReader(s.stream, entry.info.Size()), unlock: s.mu.Unlock}, nil
+}
+
+// streamEntry libère le flux du tar compressé à la fermeture
+type streamEntry struct {
+	io.Reader
+	unlock func()
+	once   sync.Once
+}
+
+func (e *streamEntry) Close() error {
+	e.once.Do(e.unlock)
+	return nil
+}
+
+// sortFiles ordonne la liste selon la position des entrées dans un tar compressé, pour
+// que le flux soit lu d'un bout à l'autre sans retour au début
+func (s *sourceArchive) sortFiles(files []string) []string {
+	if s.format != ArchiveTarGz {
+		return files
+	}
+	rank := func(file string) int {
+		if entry, ok := s.entries[archiveEntryName(file)]; ok {
+			return entry.ordinal
+		}
+		return -1
+	}
+	sorted := append([]string(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank(sorted[i]) < rank(sorted[j]) })
+	return sorted
+}
+
+// directory retourne les fichiers d'un répertoire de l'archive, dans l'ordre de lecture,
+// et ses sous-répertoires vides. ok est faux si le nom ne désigne pas un répertoire.
+func (s *sourceArchive) directory(name string) (files, emptyDirs []string, ok bool) {
+	dir := archiveEntryName(name)
+	if entry, found := s.entries[dir]; found && !entry.info.IsDir() {
+		return nil, nil, false
+	}
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+
+	// Répertoires de l'arborescence, marqués non vides dès qu'une entrée s'y trouve
+	dirs := make(map[string]bool)
+	for entryName, entry := range s.entries {
+		if entryName != dir && !strings.HasPrefix(entryName, prefix) {
+			continue
+		}
+		ok = true
+		if entry.info.IsDir() {
+			if _, seen := dirs[entryName]; !seen {
+				dirs[entryName] = false
+			}
+		} else {
+			files = append(files, entryName)
+		}
+		for parent := path.Dir(entryName); parent != "." && parent != dir && strings.HasPrefix(parent, prefix); parent = path.Dir(parent) {
+			dirs[parent] = true
+		}
+		if entryName != dir {
+			dirs[dir] = true
+		}
+	}
+	for d, used := range dirs {
+		if !used {
+			emptyDirs = append(emptyDirs, filepath.FromSlash(d))
+		}
+	}
+	sort.Strings(files)
+	sort.Strings(emptyDirs)
+	for i, file := range files {
+		files[i] = filepath.FromSlash(file)
+	}
+	return s.sortFiles(files), emptyDirs, ok
+}
+
+// Close ferme l'archive source
+func (s *sourceArchive) Close() error {
+	var err error
+	if s.zr != nil {
+		err = s.zr.Close()
+	}
+	if s.file != nil {
+		err = errors.Join(err, s.file.Close())
+	}
+	return err
+}
+
+// extractFile écrit une entrée de l'archive source à la destination, en conservant le mode
+// et la date enregistrés dans l'archive
+func extractFile(name string, id int, dest string, config *Config, logger *log.Logger) error {
+	archive := config.sourceArchive
+	source := filepath.Join(archive.path, name)
+	entry, err := archive.lookup(name, config.SymlinkMode == SymlinkFollow || config.SymlinkMode == "")
+	if err != nil {
+		return err
+	}
+
+	// Ne jamais écrire hors de la destination, quel que soit le nom de l'entrée
+	if rel, err := filepath.Rel(config.DestDir, dest); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%w: %s hors du répertoire de destination", ErrCopyRefused, dest)
+	}
+
+	// Créer les répertoires parents du fichier de destination si nécessaire
+	if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+		return fmt.Errorf("impossible de créer les répertoires de destination: %w", err)
+	}
+
+	// Traiter les liens symboliques selon le mode configuré
+	if entry.link != "" {
+		switch config.SymlinkMode {
+		case SymlinkCopy:
+			return writeSymlink(entry.link, source, id, dest, logger)
+		case SymlinkRefuse:
+			return fmt.Errorf("%w: %s est un lien symbolique", ErrCopyRefused, source)
+		}
+		return skipCopy(id, source, "lien symbolique", logger)
+	}
+	if entry.info.IsDir() {
+		return skipCopy(id, source, "répertoire de l'archive", logger)
+	}
+	if reason := specialFileReason(entry.info.Mode()); reason != "" {
+		return skipCopy(id, source, reason, logger)
+	}
+
+	// Comparer avec la destination existante selon la politique configurée
+	if _, err := os.Stat(dest); err == nil {
+		view := fileView{
+			stat: func() (os.FileInfo, error) { return entry.info, nil },
+			hash: func() (string, error) { return archive.hash(entry, config.HashAlgorithm) },
+		}
+		same, reason, err := compareFiles(view, destView(dest, config), config)
+		if err != nil {
+			return err
+		}
+		if same {
+			return skipCopy(id, source, fmt.Sprintf("politique %s, %s", effectivePolicy(config), reason), logger)
+		}
+	}
+
+	// Extraire l'entrée dans le fichier temporaire, avec calcul de l'empreinte au passage
+	tempPath := tempPathFor(dest)
+	digest, err := extractToTemp(archive, entry, tempPath, config)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if digest != "" {
+		logger.Printf("Worker %d: Copie vérifiée pour %s (%s)\n", id, filepath.Base(source), formatDigest(config.HashAlgorithm, digest))
+	}
+	if err := os.Chmod(tempPath, entry.info.Mode().Perm()); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de définir les permissions du fichier de destination: %w", err)
+	}
+	if err := os.Chtimes(tempPath, entry.info.ModTime(), entry.info.ModTime()); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de définir les dates du fichier de destination: %w", err)
+	}
+	if config.BackupMode != "" {
+		if err := backupDestination(id, dest, config, logger); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de renommer le fichier temporaire: %w", err)
+	}
+
+	logger.Printf("Worker %d: Copie de %s terminée (méthode %s)\n", id, filepath.Base(source), usedExtract)
+	config.stats.add(usedExtract, entry.info.Size())
+	config.limiter.count(entry.info.Size())
+	return nil
+}
+
+// extractToTemp écrit le contenu de l'entrée dans le fichier temporaire et le vérifie si
+// la vérification est activée. Retourne l'empreinte vérifiée, ou "" sans vérification.
+func extractToTemp(archive *sourceArchive, entry *sourceEntry, tempPath string, config *Config) (string, error) {
+	reader, err := archive.open(entry)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return "", fmt.Errorf("impossible de créer le fichier temporaire de destination: %w", err)
+	}
+	defer tempFile.Close()
+
+	var body io.Reader = reader
+	var hasher hash.Hash
+	if config.VerifyHash {
+		if hasher, err = newHasher(config.HashAlgorithm); err != nil {
+			return "", err
+		}
+		body = io.TeeReader(reader, hasher)
+	}
+	var writer io.Writer = tempFile
+	if config.limiter != nil {
+		writer = throttledWriter{w: tempFile, limiter: config.limiter}
+	}
+	n, err := io.Copy(writer, body)
+	if err != nil {
+		return "", fmt.Errorf("erreur lors de l'extraction: %w", err)
+	}
+	if n != entry.info.Size() {
+		return "", fmt.Errorf("entrée %s tronquée: %d octets sur %d", entry.name, n, entry.info.Size())
+	}
+	// Libérer le flux d'un tar compressé sans attendre la synchronisation
+	reader.Close()
+	if err := tempFile.Sync(); err != nil {
+		return "", fmt.Errorf("impossible de synchroniser le fichier temporaire: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return "", fmt.Errorf("impossible de fermer le fichier temporaire: %w", err)
+	}
+
+	if hasher == nil {
+		return "", nil
+	}
+	digest := fmt.Sprintf("%x", hasher.Sum(nil))
+	return digest, verifyCopy(tempPath, digest, config.HashAlgorithm)
+}
+
+// hash calcule l'empreinte du contenu d'une entrée
+func (s *sourceArchive) hash(entry *sourceEntry, algorithm string) (string, error) {
+	reader, err := s.open(entry)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return readerHash(reader, algorithm)
+}
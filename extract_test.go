@@ -0,0 +1,241 @@
+// extract_test.go
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Contenu des archives source de test
+var extractTestFiles = map[string]string{
+	"a.flac":             "contenu a",
+	"disque 1/b.flac":    "contenu b",
+	"disque 1/notes.txt": "contenu des notes",
+}
+
+var extractTestTime = time.Date(2022, 11, 3, 8, 15, 0, 0, time.UTC)
+
+// writeTestTar crée un tar, compressé ou non, avec un lien symbolique et un lien physique
+func writeTestTar(t *testing.T, path string, compressed bool) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de l'archive: %v", err)
+	}
+	defer file.Close()
+	var w io.Writer = file
+	if compressed {
+		gz := gzip.NewWriter(file)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for _, name := range []string{"a.flac", "disque 1/b.flac", "disque 1/notes.txt"} {
+		content := extractTestFiles[name]
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0640, Size: int64(len(content)), ModTime: extractTestTime, Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "lien.flac", Linkname: "a.flac", Mode: 0777, ModTime: extractTestTime, Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "copie.flac", Linkname: "disque 1/b.flac", Mode: 0640, ModTime: extractTestTime, Typeflag: tar.TypeLink})
+}
+
+// checkExtracted vérifie le contenu, le mode et la date des fichiers extraits
+func checkExtracted(t *testing.T, destDir string, expected map[string]string) {
+	t.Helper()
+	for name, want := range expected {
+		path := filepath.Join(destDir, name)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Fichier %s non extrait: %v", name, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("Contenu incorrect pour %s: %q", name, string(content))
+		}
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("Mode incorrect pour %s: %v", name, info.Mode())
+		}
+		if !info.ModTime().Equal(extractTestTime) {
+			t.Errorf("Date incorrecte pour %s: %v", name, info.ModTime())
+		}
+	}
+}
+
+func TestCopyFiles_FromTarArchives(t *testing.T) {
+	for _, name := range []string{"livraison.tar", "livraison.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "extract")
+			if err != nil {
+				t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			archivePath := filepath.Join(dir, name)
+			writeTestTar(t, archivePath, archiveFormat(name) == ArchiveTarGz)
+			config := &Config{SourceDir: archivePath, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, VerifyHash: true, HashAlgorithm: "crc32c"}
+			// Ordre différent de celui de l'archive
+			files := []string{"copie.flac", "disque 1/notes.txt", "lien.flac", "a.flac", "disque 1/b.flac"}
+			if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+				t.Fatalf("Erreur inattendue lors de l'extraction: %v", err)
+			}
+
+			expected := map[string]string{"lien.flac": "contenu a", "copie.flac": "contenu b"}
+			for name, content := range extractTestFiles {
+				expected[name] = content
+			}
+			checkExtracted(t, config.DestDir, expected)
+		})
+	}
+}
+
+func TestCopyFiles_FromZipArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "extract")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "livraison.zip")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de l'archive: %v", err)
+	}
+	zw := zip.NewWriter(file)
+	for name, content := range extractTestFiles {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: extractTestTime}
+		header.SetMode(0640)
+		w, _ := zw.CreateHeader(header)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	file.Close()
+
+	config := &Config{SourceDir: archivePath, DestDir: filepath.Join(dir, "dest"), ThreadCount: 3}
+	files := []string{"a.flac", "./disque 1/b.flac", "disque 1/notes.txt"}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de l'extraction: %v", err)
+	}
+	checkExtracted(t, config.DestDir, extractTestFiles)
+
+	// Une seconde exécution ignore les fichiers déjà extraits
+	config.stats = nil
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la seconde extraction: %v", err)
+	}
+	if n := config.stats.files[usedExtract]; n != 0 {
+		t.Errorf("Aucun fichier ne devrait être extrait de nouveau, %d extraits", n)
+	}
+}
+
+func TestSourceArchive_MissingEntry(t *testing.T) {
+	dir, err := os.MkdirTemp("", "extract")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "livraison.tar.gz")
+	writeTestTar(t, archivePath, true)
+	archive, err := openSourceArchive(archivePath)
+	if err != nil {
+		t.Fatalf("Erreur inattendue à l'ouverture de l'archive: %v", err)
+	}
+	defer archive.Close()
+
+	if _, err := archive.lookup("absent.flac", true); !os.IsNotExist(err) {
+		t.Errorf("Erreur de fichier inexistant attendue, obtenue: %v", err)
+	}
+
+	// Lecture en arrière dans le flux compressé
+	for _, name := range []string{"disque 1/notes.txt", "a.flac"} {
+		entry, _ := archive.lookup(name, true)
+		digest, err := archive.hash(entry, "md5")
+		if err != nil {
+			t.Fatalf("Erreur inattendue lors de la lecture de %s: %v", name, err)
+		}
+		if digest != computeMD5(extractTestFiles[name]) {
+			t.Errorf("Contenu incorrect pour %s", name)
+		}
+	}
+}
+
+func TestSourceArchive_ZipSlip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "extract")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Archives dont une entrée remonte au-dessus du répertoire d'extraction
+	zipPath := filepath.Join(dir, "malveillante.zip")
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de l'archive: %v", err)
+	}
+	zw := zip.NewWriter(file)
+	w, _ := zw.Create("../../evasion.txt")
+	w.Write([]byte("hors de la destination"))
+	zw.Close()
+	file.Close()
+
+	tarPath := filepath.Join(dir, "malveillante.tar")
+	file, err = os.Create(tarPath)
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de l'archive: %v", err)
+	}
+	tw := tar.NewWriter(file)
+	content := "hors de la destination"
+	tw.WriteHeader(&tar.Header{Name: "album/../../evasion.txt", Mode: 0640, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+	file.Close()
+
+	for _, archivePath := range []string{zipPath, tarPath} {
+		if archive, err := openSourceArchive(archivePath); err == nil {
+			archive.Close()
+			t.Errorf("L'archive %s aurait dû être refusée", filepath.Base(archivePath))
+		}
+		config := &Config{SourceDir: archivePath, DestDir: filepath.Join(dir, "dest", "sous"), ThreadCount: 1}
+		if err := CopyFiles(context.Background(), config, []string{"."}, InitTestLogger()); err == nil {
+			t.Errorf("La copie depuis %s aurait dû échouer", filepath.Base(archivePath))
+		}
+		if _, err := os.Stat(filepath.Join(dir, "evasion.txt")); !os.IsNotExist(err) {
+			t.Errorf("Fichier écrit hors de la destination depuis %s", filepath.Base(archivePath))
+		}
+	}
+}
+
+func TestExtractFile_OutsideDest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "extract")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "livraison.tar")
+	writeTestTar(t, archivePath, false)
+	archive, err := openSourceArchive(archivePath)
+	if err != nil {
+		t.Fatalf("Erreur inattendue à l'ouverture de l'archive: %v", err)
+	}
+	defer archive.Close()
+
+	config := &Config{SourceDir: archivePath, DestDir: filepath.Join(dir, "dest"), sourceArchive: archive}
+	dest := filepath.Join(dir, "a.flac")
+	if err := extractFile("a.flac", 0, dest, config, InitTestLogger()); !errors.Is(err, ErrCopyRefused) {
+		t.Errorf("Extraction hors de la destination: refus attendu, obtenu %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Fichier écrit hors de la destination")
+	}
+}
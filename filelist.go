@@ -3,32 +3,49 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 )
 
-func ReadFilesList(filePath string) ([]string, error) {
-	// Ouvrir le fichier contenant la liste des fichiers
-	file, err := os.Open(filePath)
+// Préfixe des lignes de commentaire de la liste
+const commentPrefix = "#"
+
+// ReadFilesList lit la liste des fichiers dans l'encodage donné ("" pour le détecter). Les
+// lignes illisibles sont signalées avec leur numéro au lieu d'aboutir à des copies en échec.
+func ReadFilesList(filePath, encoding string) ([]string, error) {
+	// Lire et décoder le fichier contenant la liste des fichiers
+	text, encoding, err := readListText(filePath, encoding)
 	if err != nil {
-		return nil, fmt.Errorf("impossible d'ouvrir la liste des fichiers: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
 	var files []string
+	var errs []error
 	// Scanner chaque ligne du fichier pour obtenir les chemins des fichiers
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
 		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			files = append(files, line)
+		// Les lignes commençant par # sont des commentaires, \# désignant un nom commençant par #
+		if line == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+		if strings.HasPrefix(line, `\`+commentPrefix) {
+			line = line[1:]
 		}
+		if err := checkListLine(line, encoding); err != nil {
+			errs = append(errs, fmt.Errorf("ligne %d: %w", lineNumber, err))
+			continue
+		}
+		files = append(files, line)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("erreur lors de la lecture de la liste des fichiers: %w", err)
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 
 	return files, nil
 }
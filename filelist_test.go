@@ -15,24 +15,24 @@ func TestReadFilesList(t *testing.T) {
 	}
 	defer os.Remove(tempFile.Name())
 
-	content := "file1.txt\nfile2.txt\n\n# Commentaire\nfile3.txt\n"
+	content := "file1.txt\nfile2.txt\n\n# Commentaire\nfile3.txt\n\\#4.txt\n"
 	if _, err := tempFile.WriteString(content); err != nil {
 		t.Fatalf("Erreur lors de l'écriture du fichier temporaire: %v", err)
 	}
 
-	files, err := ReadFilesList(tempFile.Name())
+	files, err := ReadFilesList(tempFile.Name(), "")
 	if err != nil {
 		t.Errorf("Erreur inattendue: %v", err)
 	}
 
-	expected := []string{"file1.txt", "file2.txt", "# Commentaire", "file3.txt"}
+	expected := []string{"file1.txt", "file2.txt", "file3.txt", "#4.txt"}
 	if !reflect.DeepEqual(files, expected) {
 		t.Errorf("Résultat attendu %v, obtenu %v", expected, files)
 	}
 }
 
 func TestReadFilesList_FileNotFound(t *testing.T) {
-	_, err := ReadFilesList("fichier_inexistant.txt")
+	_, err := ReadFilesList("fichier_inexistant.txt", "")
 	if err == nil {
 		t.Errorf("Une erreur était attendue pour un fichier inexistant")
 	}
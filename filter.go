@@ -0,0 +1,208 @@
+// filter.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ignoreRule est une règle de filtrage au format .gitignore
+type ignoreRule struct {
+	pattern  string
+	negate   bool // ! : réinclut les chemins exclus par une règle précédente
+	dirOnly  bool // / final : ne s'applique qu'aux répertoires
+	anchored bool // / initial ou intermédiaire : relatif à la racine du parcours
+}
+
+// parseIgnoreRule convertit une ligne au format .gitignore; ok est faux pour une ligne
+// vide ou un commentaire
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, commentPrefix) {
+		return rule, false
+	}
+	if strings.HasPrefix(line, negationPrefix) {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`+negationPrefix) || strings.HasPrefix(line, `\`+commentPrefix) {
+		line = line[1:]
+	}
+	line = filepath.ToSlash(line)
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// matches indique si la règle s'applique à un chemin relatif séparé par des /
+func (r ignoreRule) matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return matchPattern(r.pattern, name)
+	}
+	ok, _ := path.Match(r.pattern, path.Base(name))
+	return ok
+}
+
+// ignoreRules est une liste de règles dont la dernière qui s'applique l'emporte
+type ignoreRules []ignoreRule
+
+// parseIgnoreRules convertit une liste de motifs
+func parseIgnoreRules(patterns []string) ignoreRules {
+	var rules ignoreRules
+	for _, part := range patterns {
+		if rule, ok := parseIgnoreRule(part); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// loadIgnoreFile lit un fichier d'exclusions au format .gitignore
+func loadIgnoreFile(path string) (ignoreRules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("impossible d'ouvrir le fichier d'exclusions: %w", err)
+	}
+	defer file.Close()
+	var rules ignoreRules
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("erreur lors de la lecture du fichier d'exclusions: %w", err)
+	}
+	return rules, nil
+}
+
+// match indique si un chemin est retenu par les règles (la dernière applicable l'emporte)
+func (rules ignoreRules) match(name string, isDir bool) bool {
+	matched := false
+	for _, rule := range rules {
+		if rule.matches(name, isDir) {
+			matched = !rule.negate
+		}
+	}
+	return matched
+}
+
+// splitPatterns découpe une liste de motifs séparés par des virgules
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// parseTimeFilter convertit une date ("2024-01-31", "2024-01-31 18:00", RFC 3339) ou un âge
+// ("7d", "2w", "36h") en instant, l'âge étant compté depuis now
+func parseTimeFilter(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	days := map[string]int{"d": 1, "w": 7}
+	if multiplier, ok := days[value[len(value)-1:]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("âge invalide %q", value)
+		}
+		return now.AddDate(0, 0, -n*multiplier), nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return time.Time{}, fmt.Errorf("date ou âge invalide %q", value)
+	}
+	return now.Add(-age), nil
+}
+
+// walkFilter sélectionne les fichiers trouvés en parcourant un répertoire
+type walkFilter struct {
+	include, exclude     ignoreRules
+	minSize, maxSize     int64
+	newerThan, olderThan time.Time
+}
+
+// newWalkFilter construit le filtre de parcours de la configuration, nil si aucun filtre
+// n'est défini
+func newWalkFilter(config *Config) (*walkFilter, error) {
+	f := &walkFilter{
+		include:   parseIgnoreRules(config.Include),
+		exclude:   parseIgnoreRules(config.Exclude),
+		minSize:   config.MinSize,
+		maxSize:   config.MaxSize,
+		newerThan: config.NewerThan,
+		olderThan: config.OlderThan,
+	}
+	if config.ExcludeFile != "" {
+		rules, err := loadIgnoreFile(config.ExcludeFile)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, rules...)
+	}
+	if len(f.include) == 0 && len(f.exclude) == 0 && f.minSize == 0 && f.maxSize == 0 && f.newerThan.IsZero() && f.olderThan.IsZero() {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// skipDir indique si un répertoire est exclu avec tout son contenu
+func (f *walkFilter) skipDir(name string) bool {
+	return f != nil && name != "." && f.exclude.match(filepath.ToSlash(name), true)
+}
+
+// skipFile indique si un fichier est écarté par le filtre
+func (f *walkFilter) skipFile(name string, info os.FileInfo) bool {
+	if f == nil {
+		return false
+	}
+	name = filepath.ToSlash(name)
+	if len(f.include) > 0 && !f.include.match(name, false) {
+		return true
+	}
+	if f.exclude.match(name, false) {
+		return true
+	}
+	if info.Mode().IsRegular() {
+		if info.Size() < f.minSize || (f.maxSize > 0 && info.Size() > f.maxSize) {
+			return true
+		}
+	}
+	if !f.newerThan.IsZero() && !info.ModTime().After(f.newerThan) {
+		return true
+	}
+	if !f.olderThan.IsZero() && !info.ModTime().Before(f.olderThan) {
+		return true
+	}
+	return false
+}
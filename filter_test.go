@@ -0,0 +1,118 @@
+// filter_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	var rules ignoreRules
+	for _, line := range []string{"# fichiers temporaires", "*.tmp", "cache/", "/build", "docs/**/*.pdf", "!keep.tmp"} {
+		if rule, ok := parseIgnoreRule(line); ok {
+			rules = append(rules, rule)
+		}
+	}
+	cases := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"a.tmp", false, true},
+		{"album/cd1/b.tmp", false, true},
+		{"album/keep.tmp", false, false},
+		{"album/cache", true, true},
+		{"album/cache", false, false},
+		{"build", true, true},
+		{"album/build", true, false},
+		{"docs/a/b/manuel.pdf", false, true},
+		{"manuel.pdf", false, false},
+	}
+	for _, c := range cases {
+		if got := rules.match(c.name, c.isDir); got != c.want {
+			t.Errorf("match(%q, %v) = %v, attendu %v", c.name, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestParseTimeFilter(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	cases := map[string]time.Time{
+		"2024-01-31":       time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local),
+		"2024-01-31 18:30": time.Date(2024, 1, 31, 18, 30, 0, 0, time.Local),
+		"7d":               time.Date(2024, 3, 3, 12, 0, 0, 0, time.Local),
+		"2w":               time.Date(2024, 2, 25, 12, 0, 0, 0, time.Local),
+		"36h":              now.Add(-36 * time.Hour),
+	}
+	for value, want := range cases {
+		if got, err := parseTimeFilter(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseTimeFilter(%q) = %v, %v; attendu %v", value, got, err, want)
+		}
+	}
+	if _, err := parseTimeFilter("hier", now); err == nil {
+		t.Errorf("Une erreur était attendue pour une date invalide")
+	}
+}
+
+func TestCopyFiles_WalkWithFilters(t *testing.T) {
+	dir, err := os.MkdirTemp("", "filter")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	files := map[string]string{
+		"album/01.flac":       "piste 1",
+		"album/02.flac":       "piste 2",
+		"album/vide.flac":     "",
+		"album/ancien.flac":   "ancienne piste",
+		"album/brouillon.tmp": "temporaire",
+		"cache/x.flac":        "cache",
+		"notes.txt":           "notes",
+	}
+	for name, content := range files {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	os.Chtimes(filepath.Join(sourceDir, "album", "ancien.flac"), old, old)
+	excludeFile := filepath.Join(dir, "exclusions")
+	os.WriteFile(excludeFile, []byte("# exclusions\n*.tmp\ncache/\n"), 0644)
+
+	config := &Config{
+		SourceDir:   sourceDir,
+		DestDir:     filepath.Join(dir, "dest"),
+		ThreadCount: 2,
+		Include:     []string{"*.flac"},
+		ExcludeFile: excludeFile,
+		MinSize:     1,
+		NewerThan:   time.Now().Add(-24 * time.Hour),
+	}
+	// Sans liste, toute l'arborescence de la source est parcourue
+	if err := CopyFiles(context.Background(), config, []string{"."}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+
+	for name, copied := range map[string]bool{
+		"album/01.flac":       true,
+		"album/02.flac":       true,
+		"album/vide.flac":     false,
+		"album/ancien.flac":   false,
+		"album/brouillon.tmp": false,
+		"cache/x.flac":        false,
+		"notes.txt":           false,
+	} {
+		_, err := os.Stat(filepath.Join(config.DestDir, filepath.FromSlash(name)))
+		if copied && err != nil {
+			t.Errorf("%s doit être copié: %v", name, err)
+		}
+		if !copied && !os.IsNotExist(err) {
+			t.Errorf("%s doit être écarté par les filtres", name)
+		}
+	}
+}
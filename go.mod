@@ -3,3 +3,5 @@ module github.com/darksip/gocopy
 go 1.22
 
 require github.com/joho/godotenv v1.5.1
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,83 @@
+// hash.go
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+// Algorithme utilisé par défaut pour --verify-hash
+const defaultHashAlgorithm = "md5"
+
+// Table CRC32C (Castagnoli), accélérée matériellement sur la plupart des processeurs
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Registre des algorithmes de hash disponibles, indexés par leur nom canonique
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"crc32c": func() hash.Hash { return crc32.New(castagnoliTable) },
+	"xxh64":  func() hash.Hash { return newXXH64() },
+}
+
+// Noms alternatifs acceptés pour les algorithmes
+var hashAliases = map[string]string{
+	"sha-1":    "sha1",
+	"sha-256":  "sha256",
+	"sha-512":  "sha512",
+	"crc-32c":  "crc32c",
+	"xxhash":   "xxh64",
+	"xxhash64": "xxh64",
+}
+
+// normalizeHashName retourne le nom canonique d'un algorithme de hash
+func normalizeHashName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return defaultHashAlgorithm, nil
+	}
+	if canonical, ok := hashAliases[name]; ok {
+		name = canonical
+	}
+	if _, ok := hashAlgorithms[name]; !ok {
+		return "", fmt.Errorf("algorithme de hash inconnu %q (disponibles: %s)", name, strings.Join(hashNames(), ", "))
+	}
+	return name, nil
+}
+
+// newHasher crée un hash pour l'algorithme demandé
+func newHasher(name string) (hash.Hash, error) {
+	name, err := normalizeHashName(name)
+	if err != nil {
+		return nil, err
+	}
+	return hashAlgorithms[name](), nil
+}
+
+// hashNames retourne la liste triée des algorithmes disponibles
+func hashNames() []string {
+	names := make([]string, 0, len(hashAlgorithms))
+	for name := range hashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatDigest associe le nom de l'algorithme à une empreinte pour les logs
+func formatDigest(algorithm, digest string) string {
+	name, err := normalizeHashName(algorithm)
+	if err != nil {
+		name = algorithm
+	}
+	return name + ":" + digest
+}
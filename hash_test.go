@@ -0,0 +1,54 @@
+// hash_test.go
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	cases := map[string]string{
+		"":    "ef46db3751d8e999",
+		"a":   "d24ec4f1a98c6e5b",
+		"abc": "44bc2cf5ad770999",
+		"Nobody inspects the spammish repetition": "fbcea83c8a378bf1",
+	}
+	for input, expected := range cases {
+		h := newXXH64()
+		h.Write([]byte(input))
+		if got := fmt.Sprintf("%x", h.Sum(nil)); got != expected {
+			t.Errorf("xxh64(%q) attendu %s, obtenu %s", input, expected, got)
+		}
+	}
+
+	// Le résultat ne doit pas dépendre du découpage des écritures
+	data := []byte(strings.Repeat("gocopy", 100))
+	whole := newXXH64()
+	whole.Write(data)
+	chunked := newXXH64()
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		chunked.Write(data[i:end])
+	}
+	if whole.Sum64() != chunked.Sum64() {
+		t.Errorf("Le hash xxh64 dépend du découpage des écritures")
+	}
+}
+
+func TestNewHasher(t *testing.T) {
+	for _, name := range []string{"", "MD5", "sha-1", "SHA256", "sha512", "crc32c", "xxhash64"} {
+		if _, err := newHasher(name); err != nil {
+			t.Errorf("Erreur inattendue pour l'algorithme %q: %v", name, err)
+		}
+	}
+	if _, err := newHasher("rot13"); err == nil {
+		t.Errorf("Une erreur était attendue pour un algorithme inconnu")
+	}
+	if got := formatDigest("SHA-256", "abcd"); got != "sha256:abcd" {
+		t.Errorf("Empreinte formatée attendue sha256:abcd, obtenue %s", got)
+	}
+}
@@ -0,0 +1,166 @@
+// links.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Traitement des liens symboliques présents dans la liste
+const (
+	SymlinkFollow = "follow" // copier le fichier pointé
+	SymlinkCopy   = "copy"   // recréer le lien symbolique à l'identique
+	SymlinkSkip   = "skip"   // ignorer le lien
+	SymlinkRefuse = "refuse" // signaler une erreur
+)
+
+var symlinkModes = []string{SymlinkFollow, SymlinkCopy, SymlinkSkip, SymlinkRefuse}
+
+// ErrCopyRefused signale un fichier qui ne doit pas être copié, sans nouvelle tentative
+var ErrCopyRefused = errors.New("copie refusée")
+
+// normalizeSymlinkMode valide le mode de traitement des liens symboliques
+func normalizeSymlinkMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return SymlinkFollow, nil
+	}
+	for _, m := range symlinkModes {
+		if m == mode {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("mode de lien symbolique inconnu %q (disponibles: %s)", mode, strings.Join(symlinkModes, ", "))
+}
+
+// specialFileReason retourne la raison pour laquelle un fichier spécial ne peut pas être
+// copié, ou une chaîne vide pour un fichier ordinaire ou un répertoire
+func specialFileReason(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "tube nommé (FIFO)"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "fichier de périphérique"
+	case mode&os.ModeIrregular != 0:
+		return "fichier non ordinaire"
+	}
+	return ""
+}
+
+// copySymlink recrée le lien symbolique source à la destination, via un nom temporaire
+func copySymlink(source string, id int, dest string, logger *log.Logger) error {
+	target, err := os.Readlink(source)
+	if err != nil {
+		return err
+	}
+	return writeSymlink(target, source, id, dest, logger)
+}
+
+// writeSymlink crée le lien symbolique vers target à la destination, via un nom temporaire
+func writeSymlink(target, source string, id int, dest string, logger *log.Logger) error {
+	// Lien déjà présent avec la même cible
+	if existing, err := os.Readlink(dest); err == nil && existing == target {
+		return skipCopy(id, source, "lien symbolique identique", logger)
+	}
+
+	tempPath := tempPathFor(dest)
+	os.Remove(tempPath)
+	if err := os.Symlink(target, tempPath); err != nil {
+		return fmt.Errorf("impossible de créer le lien symbolique: %w", err)
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de renommer le lien symbolique: %w", err)
+	}
+	logger.Printf("Worker %d: Lien symbolique %s -> %s recréé\n", id, dest, target)
+	return nil
+}
+
+// linkTracker mémorise la première destination écrite pour chaque inode source ayant
+// plusieurs liens physiques, afin de lier les noms suivants au lieu de dupliquer le contenu
+type linkTracker struct {
+	mu      sync.Mutex
+	entries map[fileKey]*linkEntry
+}
+
+// fileKey identifie un inode source
+type fileKey struct {
+	dev, ino uint64
+}
+
+// linkEntry décrit la copie du premier nom d'un inode; done est fermé une fois terminée
+type linkEntry struct {
+	dest string
+	done chan struct{}
+	ok   bool
+}
+
+func newLinkTracker() *linkTracker {
+	return &linkTracker{entries: make(map[fileKey]*linkEntry)}
+}
+
+// claim retourne l'entrée de l'inode de la source. Si owner est vrai, l'appelant effectue
+// la copie et doit appeler finish; sinon il attend la fin de la copie du premier nom.
+func (l *linkTracker) claim(sourceInfo os.FileInfo, dest string) (entry *linkEntry, key fileKey, owner bool) {
+	if l == nil {
+		return nil, key, false
+	}
+	key, ok := hardLinkKey(sourceInfo)
+	if !ok {
+		return nil, key, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry, found := l.entries[key]; found {
+		return entry, key, entry.dest == dest
+	}
+	entry = &linkEntry{dest: dest, done: make(chan struct{})}
+	l.entries[key] = entry
+	return entry, key, true
+}
+
+// finish termine la copie du premier nom. En cas d'échec l'inode est oublié pour qu'une
+// nouvelle tentative puisse le revendiquer.
+func (l *linkTracker) finish(key fileKey, entry *linkEntry, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-entry.done:
+		return
+	default:
+	}
+	entry.ok = ok
+	if !ok {
+		delete(l.entries, key)
+	}
+	close(entry.done)
+}
+
+// hardLink crée dest comme lien physique vers first, déjà copié, via un nom temporaire
+func hardLink(first string, id int, dest string, logger *log.Logger) error {
+	firstInfo, err := os.Stat(first)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(dest); err == nil && os.SameFile(firstInfo, destInfo) {
+		return skipCopy(id, dest, "lien physique déjà présent", logger)
+	}
+
+	tempPath := tempPathFor(dest)
+	os.Remove(tempPath)
+	if err := os.Link(first, tempPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, dest); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("impossible de renommer le lien physique: %w", err)
+	}
+	logger.Printf("Worker %d: Lien physique %s créé vers %s\n", id, dest, first)
+	return nil
+}
@@ -0,0 +1,18 @@
+// links_linux.go
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinkKey retourne l'identifiant d'inode d'un fichier ayant plusieurs liens physiques
+func hardLinkKey(info os.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: stat.Ino}, true
+}
@@ -0,0 +1,38 @@
+// links_linux_test.go
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardLinkKey(t *testing.T) {
+	dir, err := os.MkdirTemp("", "links")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	single := filepath.Join(dir, "seul.flac")
+	first := filepath.Join(dir, "premier.flac")
+	second := filepath.Join(dir, "second.flac")
+	os.WriteFile(single, []byte("contenu"), 0644)
+	os.WriteFile(first, []byte("contenu"), 0644)
+	if err := os.Link(first, second); err != nil {
+		t.Skipf("Liens physiques non supportés: %v", err)
+	}
+
+	if _, ok := hardLinkKey(mustStat(t, single)); ok {
+		t.Errorf("Un fichier sans autre lien physique ne doit pas être suivi")
+	}
+	firstKey, ok := hardLinkKey(mustStat(t, first))
+	if !ok {
+		t.Fatalf("Le lien physique de %s n'a pas été détecté", first)
+	}
+	if secondKey, _ := hardLinkKey(mustStat(t, second)); secondKey != firstKey {
+		t.Errorf("Les deux noms d'un même inode doivent partager leur identifiant")
+	}
+}
@@ -0,0 +1,11 @@
+// links_other.go
+//go:build !linux
+
+package main
+
+import "os"
+
+// hardLinkKey: la détection des liens physiques n'est prise en charge que sous Linux
+func hardLinkKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
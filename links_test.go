@@ -0,0 +1,94 @@
+// links_test.go
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFile_SymlinkModes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "symlinks")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "cible.txt")
+	link := filepath.Join(dir, "lien.txt")
+	os.WriteFile(target, []byte("contenu"), 0644)
+	if err := os.Symlink("cible.txt", link); err != nil {
+		t.Skipf("Liens symboliques non supportés: %v", err)
+	}
+	logger := InitTestLogger()
+
+	// follow: le contenu pointé est copié
+	dest := filepath.Join(dir, "out", "follow.txt")
+	if err := copyFile(link, 1, dest, &Config{SymlinkMode: SymlinkFollow}, logger); err != nil {
+		t.Fatalf("Erreur inattendue en mode follow: %v", err)
+	}
+	if info, err := os.Lstat(dest); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Un fichier ordinaire était attendu en mode follow (%v)", err)
+	}
+
+	// copy: le lien est recréé avec la même cible
+	dest = filepath.Join(dir, "out", "copy.txt")
+	if err := copyFile(link, 1, dest, &Config{SymlinkMode: SymlinkCopy}, logger); err != nil {
+		t.Fatalf("Erreur inattendue en mode copy: %v", err)
+	}
+	if target, err := os.Readlink(dest); err != nil || target != "cible.txt" {
+		t.Errorf("Lien vers cible.txt attendu, obtenu %q (%v)", target, err)
+	}
+
+	// skip et refuse
+	if err := copyFile(link, 1, filepath.Join(dir, "out", "skip.txt"), &Config{SymlinkMode: SymlinkSkip}, logger); err != ErrCopyIgnored {
+		t.Errorf("Erreur attendue ErrCopyIgnored en mode skip, obtenue: %v", err)
+	}
+	if err := copyFile(link, 1, filepath.Join(dir, "out", "refuse.txt"), &Config{SymlinkMode: SymlinkRefuse}, logger); !errors.Is(err, ErrCopyRefused) {
+		t.Errorf("Erreur attendue ErrCopyRefused en mode refuse, obtenue: %v", err)
+	}
+}
+
+func TestCopyFile_HardLinks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "hardlinks")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "src", "pochette.jpg")
+	second := filepath.Join(dir, "src", "copie.jpg")
+	os.MkdirAll(filepath.Dir(first), 0755)
+	os.WriteFile(first, []byte("image"), 0644)
+	if err := os.Link(first, second); err != nil {
+		t.Skipf("Liens physiques non supportés: %v", err)
+	}
+	if _, ok := hardLinkKey(mustStat(t, first)); !ok {
+		t.Skip("Détection des liens physiques non supportée sur cette plateforme")
+	}
+
+	config := &Config{links: newLinkTracker()}
+	logger := InitTestLogger()
+	firstDest := filepath.Join(dir, "dst", "pochette.jpg")
+	secondDest := filepath.Join(dir, "dst", "copie.jpg")
+	if err := copyFile(first, 1, firstDest, config, logger); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	if err := copyFile(second, 1, secondDest, config, logger); err != nil {
+		t.Fatalf("Erreur inattendue lors de la liaison: %v", err)
+	}
+	if !os.SameFile(mustStat(t, firstDest), mustStat(t, secondDest)) {
+		t.Errorf("Les deux destinations devraient partager le même inode")
+	}
+}
+
+// Fonction auxiliaire pour lire les informations d'un fichier
+func mustStat(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Erreur lors de la lecture de %s: %v", path, err)
+	}
+	return info
+}
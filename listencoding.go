@@ -0,0 +1,144 @@
+// listencoding.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Encodages acceptés pour la liste des fichiers
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingCP1252  = "windows-1252"
+)
+
+var listEncodings = []string{EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingCP1252}
+
+// Noms alternatifs acceptés pour les encodages
+var encodingAliases = map[string]string{
+	"utf8":       EncodingUTF8,
+	"utf16le":    EncodingUTF16LE,
+	"utf-16":     EncodingUTF16LE,
+	"utf16":      EncodingUTF16LE,
+	"unicode":    EncodingUTF16LE,
+	"utf16be":    EncodingUTF16BE,
+	"cp1252":     EncodingCP1252,
+	"latin1":     EncodingCP1252,
+	"latin-1":    EncodingCP1252,
+	"iso-8859-1": EncodingCP1252,
+	"ansi":       EncodingCP1252,
+}
+
+// Marques d'ordre des octets en tête de fichier
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// normalizeListEncoding valide l'encodage de la liste ("" pour le détecter)
+func normalizeListEncoding(encoding string) (string, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if canonical, ok := encodingAliases[encoding]; ok {
+		encoding = canonical
+	}
+	switch encoding {
+	case "", EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingCP1252:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("encodage inconnu %q (disponibles: %s)", encoding, strings.Join(listEncodings, ", "))
+}
+
+// detectListEncoding déduit l'encodage de la marque d'ordre des octets, ou des octets nuls
+// d'un texte UTF-16 sans marque. A défaut, la liste est lue en UTF-8.
+func detectListEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+		return EncodingUTF16LE
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		return EncodingUTF16BE
+	}
+	return EncodingUTF8
+}
+
+// decodeList convertit le contenu de la liste en UTF-8, sans sa marque d'ordre des octets.
+// Les séquences invalides sont conservées ou remplacées par U+FFFD, pour être signalées
+// avec leur numéro de ligne par checkListLine.
+func decodeList(data []byte, encoding string) (string, string, error) {
+	if encoding == "" {
+		encoding = detectListEncoding(data)
+	}
+	var decoder transform.Transformer
+	switch encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if len(data)%2 != 0 {
+			return "", encoding, fmt.Errorf("taille impaire pour une liste en %s", encoding)
+		}
+		decoder = utf16Encoding(data, encoding).NewDecoder()
+	case EncodingCP1252:
+		decoder = charmap.Windows1252.NewDecoder()
+	default:
+		return string(bytes.TrimPrefix(data, bomUTF8)), encoding, nil
+	}
+	text, err := io.ReadAll(transform.NewReader(bytes.NewReader(data), decoder))
+	if err != nil {
+		return "", encoding, fmt.Errorf("impossible de décoder la liste en %s: %w", encoding, err)
+	}
+	return string(text), encoding, nil
+}
+
+// utf16Encoding retourne le décodeur UTF-16 de l'ordre demandé. Une marque d'ordre des
+// octets présente est attendue et retirée, l'ordre qu'elle indique primant.
+func utf16Encoding(data []byte, name string) encoding.Encoding {
+	order, bom := unicode.LittleEndian, bomUTF16LE
+	if name == EncodingUTF16BE {
+		order, bom = unicode.BigEndian, bomUTF16BE
+	}
+	if bytes.HasPrefix(data, bom) {
+		return unicode.UTF16(order, unicode.ExpectBOM)
+	}
+	return unicode.UTF16(order, unicode.IgnoreBOM)
+}
+
+// readListText lit la liste des fichiers et la convertit en UTF-8
+func readListText(path, encoding string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("impossible d'ouvrir la liste des fichiers: %w", err)
+	}
+	return decodeList(data, encoding)
+}
+
+// checkListLine signale les caractères qu'un chemin ne peut pas contenir, résultant
+// généralement d'une liste lue avec le mauvais encodage
+func checkListLine(line, encoding string) error {
+	if !utf8.ValidString(line) {
+		return fmt.Errorf("séquence UTF-8 invalide (LIST_ENCODING=%s peut convenir)", EncodingCP1252)
+	}
+	for _, r := range line {
+		if r == utf8.RuneError {
+			return fmt.Errorf("caractère invalide en %s", encoding)
+		}
+		if r < 0x20 && r != '\t' || r >= 0x7F && r < 0xA0 {
+			return fmt.Errorf("caractère de contrôle %U (mauvais encodage de la liste ?)", r)
+		}
+	}
+	return nil
+}
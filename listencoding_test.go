@@ -0,0 +1,114 @@
+// listencoding_test.go
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encode un texte en UTF-16 avec sa marque d'ordre des octets
+func encodeUTF16(text string, order binary.AppendByteOrder, bom []byte) []byte {
+	data := append([]byte(nil), bom...)
+	for _, unit := range utf16.Encode([]rune(text)) {
+		data = order.AppendUint16(data, unit)
+	}
+	return data
+}
+
+func TestReadFilesList_Encodings(t *testing.T) {
+	dir, err := os.MkdirTemp("", "listencoding")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	text := "Beyoncé/01 – Intro.flac\r\nMotörhead/02.flac\r\n"
+	expected := []string{"Beyoncé/01 – Intro.flac", "Motörhead/02.flac"}
+	cases := []struct {
+		name     string
+		data     []byte
+		encoding string
+	}{
+		{"utf8-bom", append(append([]byte(nil), bomUTF8...), text...), ""},
+		{"utf16le-bom", encodeUTF16(text, binary.LittleEndian, bomUTF16LE), ""},
+		{"utf16be-bom", encodeUTF16(text, binary.BigEndian, bomUTF16BE), ""},
+		{"utf16le-sans-bom", encodeUTF16(text, binary.LittleEndian, nil), ""},
+		{"utf16be-explicite", encodeUTF16(text, binary.BigEndian, nil), EncodingUTF16BE},
+		{"cp1252", []byte("Beyonc\xe9/01 \x96 Intro.flac\r\nMot\xf6rhead/02.flac\r\n"), EncodingCP1252},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name+".txt")
+		os.WriteFile(path, c.data, 0644)
+		files, err := ReadFilesList(path, c.encoding)
+		if err != nil {
+			t.Errorf("%s: erreur inattendue: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("%s: résultat attendu %q, obtenu %q", c.name, expected, files)
+		}
+	}
+}
+
+func TestReadFilesList_InvalidLines(t *testing.T) {
+	dir, err := os.MkdirTemp("", "listencoding")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Liste Windows-1252 lue en UTF-8: seules les lignes accentuées sont signalées
+	path := filepath.Join(dir, "liste.txt")
+	os.WriteFile(path, []byte("a.flac\nBeyonc\xe9.flac\nb.flac\nMot\xf6rhead.flac\n"), 0644)
+	_, err = ReadFilesList(path, "")
+	if err == nil || !strings.Contains(err.Error(), "ligne 2") || !strings.Contains(err.Error(), "ligne 4") || strings.Contains(err.Error(), "ligne 3") {
+		t.Errorf("Les lignes 2 et 4 devaient être signalées, obtenu: %v", err)
+	}
+
+	// Octet non défini en Windows-1252
+	os.WriteFile(path, []byte("a.flac\nb\x81.flac\n"), 0644)
+	if _, err := ReadFilesList(path, EncodingCP1252); err == nil || !strings.Contains(err.Error(), "ligne 2") {
+		t.Errorf("La ligne 2 devait être signalée, obtenu: %v", err)
+	}
+
+	// UTF-16 de taille impaire
+	os.WriteFile(path, append(encodeUTF16("a.flac\n", binary.LittleEndian, bomUTF16LE), 'x'), 0644)
+	if _, err := ReadFilesList(path, ""); err == nil {
+		t.Errorf("Une erreur était attendue pour une liste UTF-16 tronquée")
+	}
+}
+
+func TestReadCSVList_UTF16(t *testing.T) {
+	dir, err := os.MkdirTemp("", "listencoding")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Export Excel « Texte Unicode »: UTF-16LE avec tabulations
+	path := filepath.Join(dir, "liste.csv")
+	os.WriteFile(path, encodeUTF16("source\tdest\r\nBeyoncé.flac\tB.flac\r\n", binary.LittleEndian, bomUTF16LE), 0644)
+	files, entries, err := ReadCSVList(path, &Config{})
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if len(files) != 1 || files[0] != "Beyoncé.flac" || entries["Beyoncé.flac"].dest != "B.flac" {
+		t.Errorf("Liste UTF-16 mal lue: %q", files)
+	}
+}
+
+func TestNormalizeListEncoding(t *testing.T) {
+	for value, want := range map[string]string{"": "", "UTF8": EncodingUTF8, "utf-16": EncodingUTF16LE, "Latin1": EncodingCP1252} {
+		if got, err := normalizeListEncoding(value); err != nil || got != want {
+			t.Errorf("normalizeListEncoding(%q) = %q, %v; attendu %q", value, got, err, want)
+		}
+	}
+	if _, err := normalizeListEncoding("ebcdic"); err == nil {
+		t.Errorf("Une erreur était attendue pour un encodage inconnu")
+	}
+}
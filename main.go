@@ -8,13 +8,53 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
+	// Sous-commande de restauration des fichiers chiffrés
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		if err := runDecrypt(os.Args[2:]); err != nil {
+			log.Fatalf("Erreur lors du déchiffrement: %v", err)
+		}
+		return
+	}
+
 	// Add a new flag for hash verification
 	verifyHash := flag.Bool("verify-hash", false, "Activate hash verification during file copy")
+	hashAlgorithm := flag.String("hash", "", "Hash algorithm for --verify-hash: "+strings.Join(hashNames(), ", ")+" (default HASH_ALGORITHM or md5)")
+	comparePolicy := flag.String("compare", "", "Comparison policy for existing destinations: "+strings.Join(comparePolicies, ", ")+" (default COMPARE_POLICY, checksum with --verify-hash, else size-mtime)")
+	mtimeTolerance := flag.Duration("mtime-tolerance", 0, "Tolerance on modification times (default MTIME_TOLERANCE)")
+	ignoreDST := flag.Bool("ignore-dst", false, "Ignore exact one-hour modification time offsets (DST on FAT volumes)")
+	preserve := flag.String("preserve", "", "Attributes to preserve: "+strings.Join(preserveAttributes, ",")+" or all (default PRESERVE or mode)")
+	symlinkMode := flag.String("symlinks", "", "Symbolic link handling: "+strings.Join(symlinkModes, ", ")+" (default SYMLINK_MODE or follow)")
+	copyMethod := flag.String("copy-method", "", "Copy method: "+strings.Join(copyMethods, ", ")+" (default COPY_METHOD or auto)")
+	bandwidthLimit := flag.String("bwlimit", "", "Global bandwidth limit shared by all workers, e.g. 50MB/s (default BANDWIDTH_LIMIT or unlimited)")
+	chunkThreshold := flag.String("chunk-threshold", "", "Copy files at least this large in parallel chunks, e.g. 1GB (default CHUNK_THRESHOLD or disabled)")
+	move := flag.Bool("move", false, "Delete each source file once its copy is verified (requires --verify-hash)")
+	moveUnverified := flag.Bool("move-unverified", false, "Allow --move to delete sources without hash verification")
+	delta := flag.Bool("delta", false, "Transfer only the changed blocks of files that already exist at the destination (the destination is read in full: use it when reading the destination is cheaper than writing to it)")
+	encryptKeyFile := flag.String("encrypt-key-file", "", "Encrypt files written to the destination with the AES-256 key in this file (default ENCRYPTION_KEY or ENCRYPTION_KEY_FILE)")
+	casMode := flag.String("cas", "", "Store each content once under its digest in DEST_DIR: "+strings.Join(casModes, ", ")+" (default CAS or disabled)")
+	backupMode := flag.String("backup", "", "Keep replaced destination files: "+strings.Join(backupModes, ", ")+" (default BACKUP or disabled)")
+	backupDir := flag.String("backup-dir", "", "Backup tree for --backup=dir (default BACKUP_DIR)")
+	backupKeep := flag.Int("backup-keep", -1, "Number of backup versions kept per file, 0 for unlimited (default BACKUP_KEEP or 0)")
+	sanitizeMode := flag.String("sanitize", "", "Adapt destination names for Windows/SMB: "+strings.Join(sanitizeModes, ", ")+" (default SANITIZE or disabled)")
+	collisionMode := flag.String("collisions", "", "Detect names differing only by case or Unicode normalisation: "+strings.Join(collisionModes, ", ")+" (default NAME_COLLISIONS or disabled)")
+	emptyDirs := flag.Bool("empty-dirs", false, "Recreate empty directories found under directory entries of the list")
+	include := flag.String("include", "", "Comma-separated patterns of files to copy when walking directories (default INCLUDE)")
+	exclude := flag.String("exclude", "", "Comma-separated patterns of files and directories to skip when walking directories (default EXCLUDE)")
+	excludeFrom := flag.String("exclude-from", "", "File of exclusion patterns in .gitignore syntax (default EXCLUDE_FROM)")
+	minSize := flag.String("min-size", "", "Skip walked files smaller than this size, e.g. 1MB (default MIN_SIZE)")
+	maxSize := flag.String("max-size", "", "Skip walked files larger than this size, e.g. 4GB (default MAX_SIZE)")
+	newerThan := flag.String("newer-than", "", "Only copy walked files modified after this date or age, e.g. 2024-01-31 or 7d (default NEWER_THAN)")
+	olderThan := flag.String("older-than", "", "Only copy walked files modified before this date or age (default OLDER_THAN)")
+	listFormatFlag := flag.String("list-format", "", "File list format: "+strings.Join(listFormats, ", ")+" (default LIST_FORMAT, or from the list extension)")
+	listDelimiter := flag.String("list-delimiter", "", "Column delimiter of CSV lists, e.g. ';' or tab (default LIST_DELIMITER, or detected from the header)")
+	listQuoting := flag.String("list-quoting", "", "Quoting of CSV lists: "+QuotingDouble+" or "+QuotingNone+" (default LIST_QUOTING or double)")
+	listEncoding := flag.String("list-encoding", "", "File list encoding: "+strings.Join(listEncodings, ", ")+" (default LIST_ENCODING, or detected from the byte order mark)")
 	flag.Parse()
 	// Charger et valider la configuration
 	config, err := LoadConfig()
@@ -24,16 +64,193 @@ func main() {
 
 	// Add the hash verification flag to the config
 	config.VerifyHash = *verifyHash
+	if *hashAlgorithm != "" {
+		config.HashAlgorithm, err = normalizeHashName(*hashAlgorithm)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *comparePolicy != "" {
+		config.ComparePolicy, err = normalizePolicy(*comparePolicy)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *mtimeTolerance > 0 {
+		config.MtimeTolerance = *mtimeTolerance
+	}
+	if *ignoreDST {
+		config.IgnoreDSTOffset = true
+	}
+	if *preserve != "" {
+		config.Preserve, err = parsePreserve(*preserve)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *symlinkMode != "" {
+		config.SymlinkMode, err = normalizeSymlinkMode(*symlinkMode)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *copyMethod != "" {
+		config.CopyMethod, err = normalizeCopyMethod(*copyMethod)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *bandwidthLimit != "" {
+		config.BandwidthLimit, err = parseRate(*bandwidthLimit)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *chunkThreshold != "" {
+		config.ChunkThreshold, err = parseSize(*chunkThreshold)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *move {
+		config.Move = true
+	}
+	if *moveUnverified {
+		config.MoveUnverified = true
+	}
+	if *delta {
+		config.Delta = true
+	}
+	if *encryptKeyFile != "" {
+		config.EncryptionKey, err = loadKey("", *encryptKeyFile)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *casMode != "" {
+		config.CASMode, err = normalizeCASMode(*casMode)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *backupMode != "" || *backupDir != "" {
+		if *backupDir != "" {
+			config.BackupDir = *backupDir
+		}
+		mode := *backupMode
+		if mode == "" {
+			mode = config.BackupMode
+		}
+		config.BackupMode, err = normalizeBackupMode(mode, config.BackupDir)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *backupKeep >= 0 {
+		config.BackupKeep = *backupKeep
+	}
+	if *sanitizeMode != "" {
+		config.SanitizeMode, err = normalizeSanitizeMode(*sanitizeMode)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *collisionMode != "" {
+		config.CollisionMode, err = normalizeCollisionMode(*collisionMode)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *emptyDirs {
+		config.EmptyDirs = true
+	}
+	if *include != "" {
+		config.Include = splitPatterns(*include)
+	}
+	if *exclude != "" {
+		config.Exclude = splitPatterns(*exclude)
+	}
+	if *excludeFrom != "" {
+		config.ExcludeFile = *excludeFrom
+	}
+	if *minSize != "" {
+		config.MinSize, err = parseSize(*minSize)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *maxSize != "" {
+		config.MaxSize, err = parseSize(*maxSize)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *newerThan != "" {
+		config.NewerThan, err = parseTimeFilter(*newerThan, time.Now())
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *olderThan != "" {
+		config.OlderThan, err = parseTimeFilter(*olderThan, time.Now())
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *listFormatFlag != "" {
+		config.ListFormat, err = normalizeListFormat(*listFormatFlag)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *listDelimiter != "" {
+		config.ListDelimiter, err = parseDelimiter(*listDelimiter)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *listQuoting != "" {
+		config.ListQuoting, err = normalizeQuoting(*listQuoting)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if *listEncoding != "" {
+		config.ListEncoding, err = normalizeListEncoding(*listEncoding)
+		if err != nil {
+			log.Fatalf("Erreur de configuration: %v", err)
+		}
+	}
+	if err := validateMove(config); err != nil {
+		log.Fatalf("Erreur de configuration: %v", err)
+	}
 	// Initialiser le logger
 	logger, err := InitLogger("copy.log")
 	if err != nil {
 		log.Fatalf("Erreur lors de l'initialisation du logger: %v", err)
 	}
 
-	// Lire la liste des fichiers à copier
-	files, err := ReadFilesList(config.FilesListPath)
-	if err != nil {
-		logger.Fatalf("Erreur lors de la lecture de la liste des fichiers: %v", err)
+	// Lire la liste des fichiers à copier, ou parcourir toute la source en l'absence de liste
+	files := []string{"."}
+	if config.FilesListPath != "" && listFormat(config.FilesListPath, config.ListFormat) != ListText {
+		// Liste CSV: destination, taille et empreinte attendues par ligne
+		files, config.listEntries, err = ReadCSVList(config.FilesListPath, config)
+		if err != nil {
+			logger.Fatalf("Erreur lors de la lecture de la liste des fichiers: %v", err)
+		}
+		logger.Printf("Liste CSV %s: %d fichiers\n", config.FilesListPath, len(files))
+	} else if config.FilesListPath != "" {
+		files, err = ReadFilesList(config.FilesListPath, config.ListEncoding)
+		if err != nil {
+			logger.Fatalf("Erreur lors de la lecture de la liste des fichiers: %v", err)
+		}
+		// Développer les motifs de la liste avant le lancement des workers
+		files, err = ExpandFilesList(files, config.SourceDir, logger)
+		if err != nil {
+			logger.Fatalf("Erreur lors du développement de la liste des fichiers: %v", err)
+		}
+	} else {
+		logger.Printf("Aucune liste de fichiers: copie de toute l'arborescence de %s\n", config.SourceDir)
 	}
 
 	// Contexte pour la gestion des interruptions
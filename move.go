@@ -0,0 +1,169 @@
+// move.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// validateMove refuse le mode déplacement sans vérification des empreintes, sauf
+// dérogation explicite
+func validateMove(config *Config) error {
+	if config.Move && !config.VerifyHash && !config.MoveUnverified {
+		return fmt.Errorf("le mode --move exige --verify-hash (ou --move-unverified pour supprimer les sources sans vérification)")
+	}
+	if config.Move && archiveFormat(config.SourceDir) != "" {
+		return fmt.Errorf("le mode --move est impossible avec une archive source")
+	}
+	return nil
+}
+
+// removeMovedSource supprime la source une fois la destination validée. Après une copie,
+// copyFile a déjà vérifié les empreintes si la vérification est activée; une copie ignorée
+// n'ayant pas été relue, les empreintes sont alors comparées avant la suppression.
+func removeMovedSource(id int, file, sourcePath, destPath string, copied bool, config *Config, logger *log.Logger) error {
+	sourceInfo, err := os.Lstat(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	// Dans une archive, le fichier vient d'être écrit et vérifié mais n'existe que dans
+	// l'archive temporaire: la source n'est supprimée qu'une fois l'archive terminée
+	if copied && config.archive != nil {
+		config.pendingSources.add(id, file, sourcePath)
+		logger.Printf("Worker %d: Suppression de la source %s différée jusqu'à la fin de l'archive\n", id, sourcePath)
+		return nil
+	}
+	// Dans l'index du stockage par contenu, le nom du fichier n'est conservé qu'à
+	// l'enregistrement de l'index en fin de copie: la source est supprimée ensuite
+	if config.cas != nil && config.cas.mode == CASIndex && sourceInfo.Mode().IsRegular() {
+		if _, indexed := config.cas.indexed(file); copied || indexed {
+			config.pendingSources.add(id, file, sourcePath)
+			logger.Printf("Worker %d: Suppression de la source %s différée jusqu'à l'enregistrement de l'index\n", id, sourcePath)
+			return nil
+		}
+	}
+	// Dans le stockage par contenu, le fichier vient d'être écrit, vérifié et lié à son
+	// chemin logique
+	if copied && config.cas != nil {
+		return removeSource(id, file, sourcePath, config, logger)
+	}
+	if _, err := os.Lstat(destPath); err != nil {
+		return fmt.Errorf("source %s conservée, destination introuvable: %w", sourcePath, err)
+	}
+
+	if !copied && sourceInfo.Mode().IsRegular() {
+		// Une destination chiffrée est comparée par son contenu en clair
+		dest := destView(destPath, config)
+		destInfo, err := dest.stat()
+		if err != nil {
+			return err
+		}
+		if !destInfo.Mode().IsRegular() || destInfo.Size() != sourceInfo.Size() {
+			return fmt.Errorf("source %s conservée, la destination %s ne lui correspond pas", sourcePath, destPath)
+		}
+		if config.VerifyHash {
+			sourceDigest, err := fileHash(sourcePath, config.HashAlgorithm)
+			if err != nil {
+				return err
+			}
+			destDigest, err := dest.hash()
+			if err != nil {
+				return err
+			}
+			if sourceDigest != destDigest {
+				return fmt.Errorf("source %s conservée: %w: source %s, destination %s", sourcePath, ErrHashMismatch,
+					formatDigest(config.HashAlgorithm, sourceDigest), formatDigest(config.HashAlgorithm, destDigest))
+			}
+		}
+	}
+
+	return removeSource(id, file, sourcePath, config, logger)
+}
+
+// removeSource supprime la source et mémorise son répertoire pour l'élagage final
+func removeSource(id int, file, sourcePath string, config *Config, logger *log.Logger) error {
+	if err := os.Remove(sourcePath); err != nil {
+		return fmt.Errorf("impossible de supprimer la source %s: %w", sourcePath, err)
+	}
+	config.movedDirs.add(file)
+	logger.Printf("Worker %d: Source %s supprimée après copie\n", id, sourcePath)
+	return nil
+}
+
+// pendingSource est une source dont la suppression attend que la destination soit publiée
+type pendingSource struct {
+	id         int
+	file       string
+	sourcePath string
+}
+
+// pendingSources mémorise les sources déplacées vers une destination qui n'est pas encore
+// publiée (archive temporaire, index du stockage par contenu)
+type pendingSources struct {
+	mu      sync.Mutex
+	sources []pendingSource
+}
+
+func newPendingSources() *pendingSources {
+	return &pendingSources{}
+}
+
+// add mémorise une source à supprimer une fois la destination publiée
+func (p *pendingSources) add(id int, file, sourcePath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sources = append(p.sources, pendingSource{id: id, file: file, sourcePath: sourcePath})
+}
+
+// take retourne les sources en attente et vide la liste
+func (p *pendingSources) take() []pendingSource {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sources := p.sources
+	p.sources = nil
+	return sources
+}
+
+// remove supprime les sources en attente, la destination étant publiée
+func (p *pendingSources) remove(config *Config, logger *log.Logger) error {
+	var errs []error
+	for _, source := range p.take() {
+		if err := removeSource(source.id, source.file, source.sourcePath, config, logger); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// keep abandonne la suppression des sources en attente, la destination n'ayant pas été publiée
+func (p *pendingSources) keep(reason string, logger *log.Logger) {
+	if sources := p.take(); len(sources) > 0 {
+		logger.Printf("%d sources conservées: %s\n", len(sources), reason)
+	}
+}
+
+// pruneEmptyDirs supprime les répertoires source vidés par le déplacement, sans jamais
+// supprimer la racine
+func pruneEmptyDirs(dirs *dirSet, sourceDir string, logger *log.Logger) {
+	for _, dir := range dirs.deepestFirst() {
+		if dir == "." {
+			continue
+		}
+		path := filepath.Join(sourceDir, dir)
+		entries, err := os.ReadDir(path)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			logger.Printf("Répertoire source vide supprimé: %s\n", path)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// move_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateMove(t *testing.T) {
+	if err := validateMove(&Config{Move: true}); err == nil {
+		t.Errorf("Le déplacement sans vérification devrait être refusé")
+	}
+	if err := validateMove(&Config{Move: true, VerifyHash: true}); err != nil {
+		t.Errorf("Erreur inattendue avec vérification: %v", err)
+	}
+	if err := validateMove(&Config{Move: true, MoveUnverified: true}); err != nil {
+		t.Errorf("Erreur inattendue avec dérogation: %v", err)
+	}
+}
+
+func TestCopyFiles_Move(t *testing.T) {
+	dir, err := os.MkdirTemp("", "move")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		SourceDir:   filepath.Join(dir, "src"),
+		DestDir:     filepath.Join(dir, "dst"),
+		ThreadCount: 2,
+		VerifyHash:  true,
+		Move:        true,
+	}
+	files := []string{filepath.Join("livraison", "a.flac"), filepath.Join("livraison", "b.flac")}
+	for _, file := range files {
+		path := filepath.Join(config.SourceDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("contenu "+file), 0644)
+	}
+
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors du déplacement: %v", err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(config.DestDir, file)); err != nil {
+			t.Errorf("Destination %s manquante: %v", file, err)
+		}
+		if _, err := os.Stat(filepath.Join(config.SourceDir, file)); !os.IsNotExist(err) {
+			t.Errorf("La source %s aurait dû être supprimée", file)
+		}
+	}
+	// Le répertoire vidé est supprimé, pas la racine
+	if _, err := os.Stat(filepath.Join(config.SourceDir, "livraison")); !os.IsNotExist(err) {
+		t.Errorf("Le répertoire source vide aurait dû être supprimé")
+	}
+	if _, err := os.Stat(config.SourceDir); err != nil {
+		t.Errorf("La racine source ne doit pas être supprimée: %v", err)
+	}
+}
+
+func TestCopyFiles_MoveToArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "move")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files, _ := archiveTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "livraison.tar"), ThreadCount: 2, VerifyHash: true, HashAlgorithm: "sha256", Move: true}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors du déplacement vers l'archive: %v", err)
+	}
+	if _, err := os.Stat(config.DestDir); err != nil {
+		t.Fatalf("Archive introuvable: %v", err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(sourceDir, file)); !os.IsNotExist(err) {
+			t.Errorf("La source %s aurait dû être supprimée après la publication de l'archive", file)
+		}
+	}
+}
+
+func TestCopyFiles_MoveToArchiveFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "move")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files, _ := archiveTestSource(t, sourceDir)
+	// Un répertoire non vide au nom de l'archive empêche sa publication
+	archivePath := filepath.Join(dir, "livraison.tar")
+	os.MkdirAll(filepath.Join(archivePath, "occupé"), 0755)
+
+	config := &Config{SourceDir: sourceDir, DestDir: archivePath, ThreadCount: 2, VerifyHash: true, HashAlgorithm: "sha256", Move: true}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err == nil {
+		t.Fatalf("La publication de l'archive aurait dû échouer")
+	}
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(sourceDir, file)); err != nil {
+			t.Errorf("La source %s doit être conservée sans archive publiée: %v", file, err)
+		}
+	}
+}
+
+func TestCopyFiles_MoveToCASIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "move")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, CASMode: CASIndex, VerifyHash: true, Move: true}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors du déplacement vers l'index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, casDir, casIndexFile)); err != nil {
+		t.Fatalf("Index absent: %v", err)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(sourceDir, file)); !os.IsNotExist(err) {
+			t.Errorf("La source %s aurait dû être supprimée après l'enregistrement de l'index", file)
+		}
+	}
+}
+
+func TestCopyFiles_MoveToCASIndexFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "move")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	files := casTestSource(t, sourceDir)
+	destDir := filepath.Join(dir, "dest")
+	// Un répertoire au nom du fichier temporaire de l'index empêche son enregistrement
+	os.MkdirAll(filepath.Join(tempPathFor(filepath.Join(destDir, casDir, casIndexFile)), "occupé"), 0755)
+
+	config := &Config{SourceDir: sourceDir, DestDir: destDir, ThreadCount: 2, CASMode: CASIndex, VerifyHash: true, Move: true}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err == nil {
+		t.Fatalf("L'enregistrement de l'index aurait dû échouer")
+	}
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(sourceDir, file)); err != nil {
+			t.Errorf("La source %s doit être conservée sans index enregistré: %v", file, err)
+		}
+	}
+}
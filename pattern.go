@@ -0,0 +1,224 @@
+// pattern.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Préfixe des lignes de la liste qui excluent les fichiers correspondants, et sa forme
+// échappée pour un nom commençant par !
+const (
+	negationPrefix  = "!"
+	escapedNegation = `\!`
+)
+
+// isPattern indique si une ligne de la liste contient des caractères de motif
+func isPattern(line string) bool {
+	return strings.ContainsAny(line, "*?[")
+}
+
+// matchPattern indique si un chemin relatif (séparé par des /) correspond à un motif.
+// Chaque segment suit la syntaxe de path.Match; un segment ** correspond à un nombre
+// quelconque de répertoires, y compris aucun.
+func matchPattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Regrouper les ** consécutifs puis essayer chaque longueur de correspondance
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i < len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// sourceFiles retourne les fichiers de SOURCE_DIR, ou les entrées de l'archive source,
+// sous forme de chemins relatifs séparés par des / et triés
+func sourceFiles(sourceDir string) ([]string, error) {
+	var files []string
+	if archiveFormat(sourceDir) != "" {
+		source, err := openSourceArchive(sourceDir)
+		if err != nil {
+			return nil, err
+		}
+		defer source.Close()
+		for name, entry := range source.entries {
+			if !entry.info.IsDir() {
+				files = append(files, name)
+			}
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	err := filepath.WalkDir(sourceDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(sourceDir, file)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("impossible de parcourir %s: %w", sourceDir, err)
+	}
+	return files, nil
+}
+
+// ExpandFilesList développe les motifs de la liste contre SOURCE_DIR. Les lignes sont
+// traitées dans l'ordre: un chemin littéral est ajouté tel quel, un motif ajoute les
+// fichiers qui lui correspondent et une ligne commençant par ! retire les fichiers déjà
+// retenus qui lui correspondent. Une ligne contenant des caractères de motif qui désigne
+// un fichier existant reste un chemin littéral. Les motifs sans correspondance sont
+// retournés en erreur.
+func ExpandFilesList(lines []string, sourceDir string, logger *log.Logger) ([]string, error) {
+	var (
+		files    []string
+		index    = make(map[string]int) // chemin -> position dans files, -1 si retiré
+		all      []string
+		loaded   bool
+		patterns int
+		errs     []error
+	)
+	add := func(file string) {
+		if i, ok := index[file]; ok && i >= 0 {
+			return
+		}
+		index[file] = len(files)
+		files = append(files, file)
+	}
+	candidates := func() ([]string, error) {
+		if !loaded {
+			var err error
+			if all, err = sourceFiles(sourceDir); err != nil {
+				return nil, err
+			}
+			loaded = true
+		}
+		return all, nil
+	}
+
+	// Liste sans motif: conservée telle quelle
+	literal := true
+	for _, line := range lines {
+		if isPattern(line) || strings.HasPrefix(line, negationPrefix) || strings.HasPrefix(line, escapedNegation) {
+			literal = false
+			break
+		}
+	}
+	if literal {
+		return lines, nil
+	}
+
+	for _, line := range lines {
+		negated := strings.HasPrefix(line, negationPrefix)
+		pattern := strings.TrimPrefix(line, negationPrefix)
+		if negated {
+			patterns++
+		} else if strings.HasPrefix(line, escapedNegation) {
+			pattern = line[1:]
+		}
+
+		// Chemin littéral, y compris un nom contenant des crochets qui existe dans la source
+		if !isPattern(pattern) || sourceExists(sourceDir, pattern) {
+			name := filepath.Clean(pattern)
+			if !negated {
+				add(name)
+			} else if i, ok := index[name]; ok && i >= 0 {
+				files[i] = ""
+				index[name] = -1
+			}
+			continue
+		}
+
+		if !negated {
+			patterns++
+		}
+		if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+			errs = append(errs, fmt.Errorf("motif invalide %q: %w", pattern, err))
+			continue
+		}
+		pattern = strings.TrimPrefix(archiveEntryName(pattern), "/")
+		if negated {
+			for name, i := range index {
+				if i >= 0 && matchPattern(pattern, filepath.ToSlash(name)) {
+					files[i] = ""
+					index[name] = -1
+				}
+			}
+			continue
+		}
+		candidates, err := candidates()
+		if err != nil {
+			return nil, err
+		}
+		matched := 0
+		for _, candidate := range candidates {
+			if matchPattern(pattern, candidate) {
+				add(filepath.FromSlash(candidate))
+				matched++
+			}
+		}
+		if matched == 0 {
+			errs = append(errs, fmt.Errorf("le motif %q ne correspond à aucun fichier de %s", line, sourceDir))
+		}
+	}
+
+	// Retirer les emplacements des fichiers exclus
+	expanded := files[:0]
+	for _, file := range files {
+		if file != "" {
+			expanded = append(expanded, file)
+		}
+	}
+	if patterns > 0 {
+		logger.Printf("Liste développée: %d lignes dont %d motifs, %d fichiers à copier\n", len(lines), patterns, len(expanded))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return expanded, nil
+}
+
+// sourceExists indique si une ligne désigne un fichier existant de SOURCE_DIR
+func sourceExists(sourceDir, name string) bool {
+	if archiveFormat(sourceDir) != "" {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(sourceDir, name))
+	return err == nil
+}
@@ -0,0 +1,83 @@
+// pattern_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.flac", "01.flac", true},
+		{"*.flac", "cd1/01.flac", false},
+		{"**/*.flac", "01.flac", true},
+		{"**/*.flac", "a/b/c/01.flac", true},
+		{"album/**", "album/cd1/01.flac", true},
+		{"album/**/cover.jpg", "album/cover.jpg", true},
+		{"album/**/cover.jpg", "album/cd1/scans/cover.jpg", true},
+		{"album/**/cover.jpg", "other/cover.jpg", false},
+		{"cd[12]/0?.flac", "cd2/07.flac", true},
+		{"cd[12]/0?.flac", "cd3/07.flac", false},
+	}
+	for _, c := range cases {
+		if got := matchPattern(c.pattern, c.name); got != c.want {
+			t.Errorf("matchPattern(%q, %q) = %v, attendu %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestExpandFilesList(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pattern")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"album/cd1/01.flac", "album/cd1/02.flac", "album/cd2/01.flac", "album/cover.jpg", "album/cd2/bonus.flac", "Live [2024]/01.flac", "!important.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(file), 0644)
+	}
+
+	lines := []string{
+		"album/**/*.flac",
+		"!album/**/bonus.flac",
+		"album/cover.jpg",
+		"Live [2024]/01.flac",
+		`\!important.txt`,
+		"album/cd1/01.flac",
+	}
+	files, err := ExpandFilesList(lines, dir, InitTestLogger())
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	expected := []string{
+		filepath.FromSlash("album/cd1/01.flac"),
+		filepath.FromSlash("album/cd1/02.flac"),
+		filepath.FromSlash("album/cd2/01.flac"),
+		filepath.FromSlash("album/cover.jpg"),
+		filepath.FromSlash("Live [2024]/01.flac"),
+		"!important.txt",
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Résultat attendu %v, obtenu %v", expected, files)
+	}
+
+	// Une liste sans motif est conservée telle quelle
+	literal := []string{"b.txt", "a.txt", "b.txt"}
+	if files, err := ExpandFilesList(literal, dir, InitTestLogger()); err != nil || !reflect.DeepEqual(files, literal) {
+		t.Errorf("Liste littérale modifiée: %v, %v", files, err)
+	}
+
+	// Un motif sans correspondance est une erreur
+	_, err = ExpandFilesList([]string{"**/*.wav", "album/*.jpg"}, dir, InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "**/*.wav") {
+		t.Errorf("Une erreur était attendue pour un motif sans correspondance, obtenue: %v", err)
+	}
+}
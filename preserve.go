@@ -0,0 +1,196 @@
+// preserve.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attributs pouvant être préservés avec --preserve
+const (
+	PreserveMode     = "mode"     // permissions
+	PreserveOwner    = "owner"    // propriétaire et groupe
+	PreserveXattr    = "xattr"    // attributs étendus
+	PreserveACL      = "acl"      // ACL POSIX (xattrs system.posix_acl_*)
+	PreserveTimes    = "times"    // date d'accès en plus de la date de modification
+	PreserveDirTimes = "dirtimes" // dates des répertoires, restaurées en fin de copie
+)
+
+var preserveAttributes = []string{PreserveMode, PreserveOwner, PreserveXattr, PreserveACL, PreserveTimes, PreserveDirTimes}
+
+// Valeur par défaut de --preserve: permissions uniquement, la date de modification
+// étant toujours copiée car elle sert aux comparaisons
+const defaultPreserve = PreserveMode
+
+// errPreserveUnsupported signale un attribut non géré sur la plateforme courante
+var errPreserveUnsupported = errors.New("non supporté sur cette plateforme")
+
+// PreserveOptions liste les attributs à préserver en plus du contenu et de la date de modification
+type PreserveOptions struct {
+	Mode     bool
+	Owner    bool
+	Xattr    bool
+	ACL      bool
+	Times    bool
+	DirTimes bool
+}
+
+// parsePreserve convertit une liste d'attributs séparés par des virgules ("all" pour tous)
+func parsePreserve(value string) (PreserveOptions, error) {
+	var opts PreserveOptions
+	if strings.TrimSpace(value) == "" {
+		value = defaultPreserve
+	}
+	for _, attr := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(attr)) {
+		case "":
+		case PreserveMode:
+			opts.Mode = true
+		case PreserveOwner:
+			opts.Owner = true
+		case PreserveXattr:
+			opts.Xattr = true
+		case PreserveACL:
+			opts.ACL = true
+		case PreserveTimes:
+			opts.Times = true
+		case PreserveDirTimes:
+			opts.DirTimes = true
+		case "all":
+			opts = PreserveOptions{true, true, true, true, true, true}
+		default:
+			return opts, fmt.Errorf("attribut inconnu %q (disponibles: %s, all)", attr, strings.Join(preserveAttributes, ", "))
+		}
+	}
+	return opts, nil
+}
+
+// preserveMetadata applique les attributs de la source sur le fichier écrit. Les échecs
+// sont retournés par attribut et n'empêchent pas la copie du fichier.
+func preserveMetadata(path, source string, sourceInfo os.FileInfo, opts PreserveOptions) []error {
+	var failures []error
+	report := func(attr string, err error) {
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", attr, err))
+		}
+	}
+
+	// Le changement de propriétaire doit précéder les permissions (il efface les bits setuid)
+	if opts.Owner {
+		report(PreserveOwner, preserveOwner(path, sourceInfo))
+	}
+	if opts.Mode {
+		report(PreserveMode, os.Chmod(path, sourceInfo.Mode()))
+	}
+	if opts.Xattr {
+		report(PreserveXattr, copyXattrs(source, path, false))
+	}
+	// Les ACL après les permissions, un chmod modifiant le masque de l'ACL
+	if opts.ACL {
+		report(PreserveACL, copyXattrs(source, path, true))
+	}
+	return failures
+}
+
+// destinationTimes retourne les dates d'accès et de modification à appliquer sur la destination
+func destinationTimes(sourceInfo os.FileInfo, opts PreserveOptions) (atime, mtime time.Time) {
+	if opts.Times {
+		return sourceAtime(sourceInfo), sourceInfo.ModTime()
+	}
+	return sourceInfo.ModTime(), sourceInfo.ModTime()
+}
+
+// dirSet mémorise les répertoires des fichiers traités, relatifs à la racine, pour un
+// traitement en fin de copie (dates des répertoires, nettoyage des répertoires vides).
+// Chaque répertoire source est associé à son nom à la destination, qui peut différer
+// lorsque les chemins sont adaptés.
+type dirSet struct {
+	mu   sync.Mutex
+	dirs map[string]string
+}
+
+func newDirSet() *dirSet {
+	return &dirSet{dirs: make(map[string]string)}
+}
+
+// add enregistre le répertoire d'un fichier et ses parents
+func (d *dirSet) add(file string) {
+	d.addMapped(file, file)
+}
+
+// addMapped enregistre le répertoire d'un fichier et ses parents avec leurs noms à la
+// destination
+func (d *dirSet) addMapped(file, destFile string) {
+	d.addDir(filepath.Dir(filepath.Clean(file)), filepath.Dir(filepath.Clean(destFile)))
+}
+
+// addDir enregistre un répertoire et ses parents avec leurs noms à la destination
+func (d *dirSet) addDir(dir, destDir string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for dir = filepath.Clean(dir); ; dir, destDir = filepath.Dir(dir), filepath.Dir(destDir) {
+		if _, ok := d.dirs[dir]; ok {
+			break
+		}
+		// Destination moins profonde que la source: les répertoires restants n'ont pas
+		// d'équivalent à la destination
+		if filepath.Clean(destDir) == "." && dir != "." {
+			break
+		}
+		d.dirs[dir] = filepath.Clean(destDir)
+		if dir == "." || dir == string(filepath.Separator) {
+			break
+		}
+	}
+}
+
+// destOf retourne le nom à la destination d'un répertoire enregistré
+func (d *dirSet) destOf(dir string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dest, ok := d.dirs[dir]; ok {
+		return dest
+	}
+	return dir
+}
+
+// deepestFirst retourne les répertoires enregistrés, des plus profonds aux moins profonds
+func (d *dirSet) deepestFirst() []string {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dirs := make([]string, 0, len(d.dirs))
+	for dir := range d.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	return dirs
+}
+
+// restoreDirTimes applique les dates des répertoires source sur les répertoires de
+// destination, une fois tous leurs fichiers écrits
+func restoreDirTimes(dirs *dirSet, sourceDir, destDir string, opts PreserveOptions, logger *log.Logger) {
+	for _, dir := range dirs.deepestFirst() {
+		info, err := os.Stat(filepath.Join(sourceDir, dir))
+		if err != nil {
+			logger.Printf("Dates non préservées pour le répertoire %s: %v\n", dir, err)
+			continue
+		}
+		atime, mtime := destinationTimes(info, opts)
+		if err := os.Chtimes(filepath.Join(destDir, dirs.destOf(dir)), atime, mtime); err != nil {
+			logger.Printf("Dates non préservées pour le répertoire %s: %v\n", dir, err)
+		}
+	}
+}
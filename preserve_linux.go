@@ -0,0 +1,98 @@
+// preserve_linux.go
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Préfixe des attributs étendus portant les ACL POSIX
+const aclXattrPrefix = "system.posix_acl_"
+
+// preserveOwner applique le propriétaire et le groupe de la source
+func preserveOwner(path string, sourceInfo os.FileInfo) error {
+	stat, ok := sourceInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errPreserveUnsupported
+	}
+	return os.Lchown(path, int(stat.Uid), int(stat.Gid))
+}
+
+// sourceAtime retourne la date de dernier accès de la source
+func sourceAtime(sourceInfo os.FileInfo) time.Time {
+	stat, ok := sourceInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sourceInfo.ModTime()
+	}
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
+
+// copyXattrs copie les attributs étendus de la source: les ACL POSIX si acl est vrai,
+// tous les autres sinon
+func copyXattrs(source, dest string, acl bool) error {
+	names, err := listXattrs(source)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range names {
+		if strings.HasPrefix(name, aclXattrPrefix) != acl {
+			continue
+		}
+		value, err := getXattr(source, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if err := syscall.Setxattr(dest, name, value, 0); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listXattrs retourne les noms des attributs étendus d'un fichier
+func listXattrs(path string) ([]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// getXattr lit la valeur d'un attribut étendu
+func getXattr(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,53 @@
+// preserve_linux_test.go
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCopyXattrs(t *testing.T) {
+	dir, err := os.MkdirTemp("", "xattr")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte("contenu"), 0644)
+	os.WriteFile(dest, []byte("contenu"), 0644)
+	if err := syscall.Setxattr(source, "user.gocopy", []byte("valeur"), 0); err != nil {
+		t.Skipf("Attributs étendus non supportés: %v", err)
+	}
+
+	if err := copyXattrs(source, dest, false); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie des attributs: %v", err)
+	}
+	value, err := getXattr(dest, "user.gocopy")
+	if err != nil || string(value) != "valeur" {
+		t.Errorf("Attribut user.gocopy attendu %q, obtenu %q (%v)", "valeur", value, err)
+	}
+}
+
+func TestCopyFile_SkipFIFO(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fifo")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "tube")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skipf("Création de FIFO impossible: %v", err)
+	}
+	// La copie d'un FIFO bloquerait indéfiniment si elle n'était pas ignorée
+	err = copyFile(fifo, 1, filepath.Join(dir, "dest"), &Config{}, InitTestLogger())
+	if err != ErrCopyIgnored {
+		t.Errorf("Erreur attendue ErrCopyIgnored pour un FIFO, obtenue: %v", err)
+	}
+}
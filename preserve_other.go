@@ -0,0 +1,24 @@
+// preserve_other.go
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// preserveOwner n'est pris en charge que sous Linux
+func preserveOwner(path string, sourceInfo os.FileInfo) error {
+	return errPreserveUnsupported
+}
+
+// sourceAtime retourne la date de modification, la date d'accès n'étant pas portable
+func sourceAtime(sourceInfo os.FileInfo) time.Time {
+	return sourceInfo.ModTime()
+}
+
+// copyXattrs n'est pris en charge que sous Linux
+func copyXattrs(source, dest string, acl bool) error {
+	return errPreserveUnsupported
+}
@@ -0,0 +1,84 @@
+// preserve_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePreserve(t *testing.T) {
+	opts, err := parsePreserve("")
+	if err != nil || opts != (PreserveOptions{Mode: true}) {
+		t.Errorf("Valeur par défaut attendue mode, obtenue %+v (%v)", opts, err)
+	}
+	opts, err = parsePreserve("owner, XATTR,dirtimes")
+	if err != nil || opts != (PreserveOptions{Owner: true, Xattr: true, DirTimes: true}) {
+		t.Errorf("Attributs inattendus %+v (%v)", opts, err)
+	}
+	if _, err := parsePreserve("mode,couleur"); err == nil {
+		t.Errorf("Une erreur était attendue pour un attribut inconnu")
+	}
+}
+
+func TestCopyFile_PreserveModeAndTimes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "preserve")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte("contenu"), 0640)
+	os.Chmod(source, 0640)
+	atime := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	mtime := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(source, atime, mtime)
+
+	config := &Config{Preserve: PreserveOptions{Mode: true, Times: true}}
+	if err := copyFile(source, 1, dest, config, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatalf("Erreur lors de la lecture de la destination: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Permissions attendues 0640, obtenues %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("Date de modification attendue %v, obtenue %v", mtime, info.ModTime())
+	}
+}
+
+func TestDirTimesRestore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dirtimes")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "src")
+	destDir := filepath.Join(dir, "dst")
+	os.MkdirAll(filepath.Join(sourceDir, "album", "cd1"), 0755)
+	os.MkdirAll(filepath.Join(destDir, "album", "cd1"), 0755)
+	mtime := time.Date(2020, 5, 4, 3, 2, 1, 0, time.UTC)
+	os.Chtimes(filepath.Join(sourceDir, "album", "cd1"), mtime, mtime)
+	os.Chtimes(filepath.Join(sourceDir, "album"), mtime, mtime)
+
+	d := newDirSet()
+	d.add(filepath.Join("album", "cd1", "piste.flac"))
+	restoreDirTimes(d, sourceDir, destDir, PreserveOptions{DirTimes: true}, InitTestLogger())
+
+	for _, sub := range []string{"album", filepath.Join("album", "cd1")} {
+		info, err := os.Stat(filepath.Join(destDir, sub))
+		if err != nil {
+			t.Fatalf("Erreur lors de la lecture de %s: %v", sub, err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("Date du répertoire %s attendue %v, obtenue %v", sub, mtime, info.ModTime())
+		}
+	}
+}
@@ -4,17 +4,39 @@ package main
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func trackProgress(totalFiles int, progressCh <-chan int) {
+// trackProgress affiche la progression. extra, s'il est fourni, corrige le nombre total
+// de fichiers à mesure que les répertoires de la liste sont parcourus.
+func trackProgress(listedFiles int, extra *atomic.Int64, progressCh <-chan int, limiter *rateLimiter) {
 	startTime := time.Now()
 	copiedFiles := 0
 	for range progressCh {
 		copiedFiles++
+		totalFiles := listedFiles
+		if extra != nil {
+			totalFiles += int(extra.Load())
+		}
+		if totalFiles < copiedFiles {
+			totalFiles = copiedFiles
+		}
 		duration := time.Since(startTime)
 		remaining := time.Duration(float64(duration) / float64(copiedFiles) * float64(totalFiles-copiedFiles))
 
+		// Avec une limite de débit, le temps restant ne peut être inférieur à celui
+		// nécessaire pour transférer le volume restant estimé au débit maximal
+		transferred := float64(limiter.bytes())
+		limit := limiter.limit()
+		if limit > 0 {
+			estimatedBytes := transferred / float64(copiedFiles) * float64(totalFiles-copiedFiles)
+			if capped := time.Duration(estimatedBytes / limit * float64(time.Second)); capped > remaining {
+				remaining = capped
+			}
+		}
+		remaining = remaining.Round(time.Second)
+
 		// Calculer le pourcentage de progression
 		percent := float64(copiedFiles) / float64(totalFiles) * 100
 
@@ -23,9 +45,15 @@ func trackProgress(totalFiles int, progressCh <-chan int) {
 		completed := int(float64(width) * float64(copiedFiles) / float64(totalFiles))
 		bar := strings.Repeat("=", completed) + strings.Repeat("-", width-completed)
 
+		// Débit moyen et limite éventuelle
+		rate := formatBytes(transferred/duration.Seconds()) + "/s"
+		if limit > 0 {
+			rate += " (limite " + describeLimit(limit) + ")"
+		}
+
 		// Afficher la barre de progression et les informations sur la même ligne
-		fmt.Printf("\r[%s] %.2f%% (%d/%d) Temps restant estimé: %v",
-			bar, percent, copiedFiles, totalFiles, remaining)
+		fmt.Printf("\r[%s] %.2f%% (%d/%d) Temps restant estimé: %v Débit: %s",
+			bar, percent, copiedFiles, totalFiles, remaining, rate)
 	}
 	// Ajouter une nouvelle ligne à la fin pour ne pas écraser la dernière mise à jour
 	fmt.Println()
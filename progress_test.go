@@ -18,6 +18,6 @@ func TestTrackProgress(t *testing.T) {
 		close(progressCh)
 	}()
 
-	trackProgress(totalFiles, progressCh)
+	trackProgress(totalFiles, nil, progressCh, nil)
 	// Si la fonction se termine correctement, le test est réussi
 }
@@ -0,0 +1,106 @@
+// resume.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// resumeOffset retourne la position à partir de laquelle la copie peut reprendre.
+// Le début du fichier temporaire d'une exécution interrompue est comparé à la même plage
+// de la source. Sans fichier temporaire, une destination plus courte que la source laissée
+// par une ancienne exécution est comparée de la même façon et son début recopié dans le
+// fichier temporaire: la destination reste en place jusqu'au renommage final. En cas de
+// divergence le fichier temporaire est supprimé et la copie repart de zéro. Avec dest
+// vide, seul un fichier temporaire existant est repris.
+func resumeOffset(sourceFile *os.File, tempPath, dest string, sourceSize int64) (int64, error) {
+	tempInfo, err := os.Stat(tempPath)
+	if os.IsNotExist(err) {
+		if dest == "" {
+			return 0, nil
+		}
+		destInfo, err := os.Stat(dest)
+		if err != nil || !destInfo.Mode().IsRegular() || destInfo.Size() == 0 || destInfo.Size() >= sourceSize {
+			return 0, nil
+		}
+		// Destination partielle: reprendre à partir d'une copie de son début
+		partial := destInfo.Size()
+		same, err := prefixMatches(sourceFile, dest, partial)
+		if err != nil || !same {
+			return 0, err
+		}
+		if err := copyPrefix(dest, tempPath, partial); err != nil {
+			os.Remove(tempPath)
+			return 0, fmt.Errorf("impossible de reprendre la destination partielle: %w", err)
+		}
+		return partial, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Un fichier temporaire qui ne correspond pas au début de la source est supprimé pour
+	// ne pas subsister si la nouvelle copie échoue avant de l'avoir écrasé
+	partial := tempInfo.Size()
+	if partial == 0 || partial > sourceSize {
+		return 0, os.Remove(tempPath)
+	}
+
+	same, err := prefixMatches(sourceFile, tempPath, partial)
+	if err != nil {
+		return 0, err
+	}
+	if !same {
+		return 0, os.Remove(tempPath)
+	}
+	return partial, nil
+}
+
+// copyPrefix recopie les n premiers octets d'une destination partielle dans le fichier
+// temporaire
+func copyPrefix(dest, tempPath string, n int64) error {
+	src, err := os.Open(dest)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(dst, src, n); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// prefixMatches compare les n premiers octets de la source et du fichier partiel
+func prefixMatches(sourceFile *os.File, partialPath string, n int64) (bool, error) {
+	partialFile, err := os.Open(partialPath)
+	if err != nil {
+		return false, err
+	}
+	defer partialFile.Close()
+
+	sourceSum, err := prefixSum(sourceFile, n)
+	if err != nil {
+		return false, fmt.Errorf("erreur lors de la lecture du début de la source: %w", err)
+	}
+	partialSum, err := prefixSum(partialFile, n)
+	if err != nil {
+		return false, fmt.Errorf("erreur lors de la lecture de la copie partielle: %w", err)
+	}
+	return bytes.Equal(sourceSum, partialSum), nil
+}
+
+// prefixSum calcule le CRC32C des n premiers octets d'un fichier
+func prefixSum(file *os.File, n int64) ([]byte, error) {
+	hasher := crc32.New(castagnoliTable)
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, n)); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
@@ -0,0 +1,112 @@
+// resume_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumeOffset(t *testing.T) {
+	dir, err := os.MkdirTemp("", "resume")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("0123456789", 1000)
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "dest.flac")
+	os.WriteFile(source, []byte(content), 0644)
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		t.Fatalf("Erreur lors de l'ouverture de la source: %v", err)
+	}
+	defer sourceFile.Close()
+
+	// Fichier temporaire dont le début correspond à la source
+	os.WriteFile(tempPathFor(dest), []byte(content[:4000]), 0644)
+	offset, err := resumeOffset(sourceFile, tempPathFor(dest), dest, int64(len(content)))
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if offset != 4000 {
+		t.Errorf("Reprise attendue à l'octet 4000, obtenue %d", offset)
+	}
+
+	// Fichier temporaire divergent: la copie doit repartir de zéro
+	os.WriteFile(tempPathFor(dest), []byte(strings.Repeat("x", 4000)), 0644)
+	offset, err = resumeOffset(sourceFile, tempPathFor(dest), dest, int64(len(content)))
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if offset != 0 {
+		t.Errorf("Reprise attendue à l'octet 0, obtenue %d", offset)
+	}
+	if _, err := os.Stat(tempPathFor(dest)); !os.IsNotExist(err) {
+		t.Errorf("Le fichier temporaire divergent devrait être supprimé")
+	}
+
+	// Destination partielle d'une ancienne exécution
+	os.Remove(tempPathFor(dest))
+	os.WriteFile(dest, []byte(content[:2500]), 0644)
+	offset, err = resumeOffset(sourceFile, tempPathFor(dest), dest, int64(len(content)))
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if offset != 2500 {
+		t.Errorf("Reprise attendue à l'octet 2500, obtenue %d", offset)
+	}
+	// La destination reste en place, son début est recopié dans le fichier temporaire
+	if kept, err := os.ReadFile(dest); err != nil || string(kept) != content[:2500] {
+		t.Errorf("La destination partielle doit rester en place: %v", err)
+	}
+	if temp, _ := os.ReadFile(tempPathFor(dest)); string(temp) != content[:2500] {
+		t.Errorf("Le fichier temporaire devrait contenir le début de la destination")
+	}
+
+	// Ancienne version plus courte et différente: conservée, la copie repart de zéro
+	os.Remove(tempPathFor(dest))
+	os.WriteFile(dest, []byte(strings.Repeat("y", 2500)), 0644)
+	offset, err = resumeOffset(sourceFile, tempPathFor(dest), dest, int64(len(content)))
+	if err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if offset != 0 {
+		t.Errorf("Reprise attendue à l'octet 0, obtenue %d", offset)
+	}
+	if kept, _ := os.ReadFile(dest); string(kept) != strings.Repeat("y", 2500) {
+		t.Errorf("L'ancienne destination ne doit pas être déplacée")
+	}
+	if _, err := os.Stat(tempPathFor(dest)); !os.IsNotExist(err) {
+		t.Errorf("Aucun fichier temporaire ne devrait être créé")
+	}
+}
+
+func TestCopyFile_ResumePartialTemp(t *testing.T) {
+	dir, err := os.MkdirTemp("", "resume")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("abcdefghij", 500)
+	source := filepath.Join(dir, "source.flac")
+	dest := filepath.Join(dir, "out", "dest.flac")
+	os.WriteFile(source, []byte(content), 0644)
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	os.WriteFile(tempPathFor(dest), []byte(content[:1234]), 0644)
+
+	if err := copyFile(source, 1, dest, &Config{}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue lors de la copie: %v", err)
+	}
+	copied, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Erreur lors de la lecture du fichier destination: %v", err)
+	}
+	if string(copied) != content {
+		t.Errorf("Contenu du fichier destination incorrect après reprise")
+	}
+}
@@ -0,0 +1,224 @@
+// sanitize.go
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Règles appliquées aux noms incompatibles avec Windows et les partages SMB
+const (
+	SanitizeReplace = "replace" // remplacer les caractères interdits
+	SanitizeEncode  = "encode"  // encoder les caractères interdits en %XX
+	SanitizeReject  = "reject"  // refuser la copie du fichier
+)
+
+var sanitizeModes = []string{SanitizeReplace, SanitizeEncode, SanitizeReject}
+
+// Caractère de remplacement par défaut et longueurs maximales, en unités UTF-16 comme
+// sous Windows. La longueur du chemin relatif laisse de la place au préfixe du partage.
+const (
+	defaultSanitizeReplacement = "_"
+	maxComponentLength         = 255
+	defaultMaxPathLength       = 240
+)
+
+// Caractères interdits dans un nom de fichier Windows, en plus des caractères de contrôle
+const windowsInvalidChars = `<>:"/\|?*`
+
+// Noms de périphériques réservés par Windows, avec ou sans extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// normalizeSanitizeMode valide le mode d'adaptation des noms ("" la désactive)
+func normalizeSanitizeMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", SanitizeReplace, SanitizeEncode, SanitizeReject:
+		return mode, nil
+	case "percent":
+		return SanitizeEncode, nil
+	}
+	return "", fmt.Errorf("mode d'adaptation des noms inconnu %q (disponibles: %s)", mode, strings.Join(sanitizeModes, ", "))
+}
+
+// validateReplacement vérifie que le caractère de remplacement est lui-même valide
+func validateReplacement(replacement string) error {
+	if utf8.RuneCountInString(replacement) != 1 || strings.ContainsAny(replacement, windowsInvalidChars+". ") || replacement[0] < 0x20 {
+		return fmt.Errorf("caractère de remplacement invalide %q", replacement)
+	}
+	return nil
+}
+
+// pathSanitizer adapte les chemins de destination et détecte les fichiers source qui
+// aboutiraient au même nom
+type pathSanitizer struct {
+	mode        string
+	replacement string
+	maxPath     int
+	mu          sync.Mutex
+	claimed     map[string]string // chemin adapté -> chemin de la liste
+}
+
+// newPathSanitizer retourne nil lorsque l'adaptation des noms est désactivée
+func newPathSanitizer(config *Config) *pathSanitizer {
+	if config.SanitizeMode == "" {
+		return nil
+	}
+	s := &pathSanitizer{
+		mode:        config.SanitizeMode,
+		replacement: config.SanitizeReplacement,
+		maxPath:     config.SanitizeMaxPath,
+		claimed:     make(map[string]string),
+	}
+	if s.replacement == "" {
+		s.replacement = defaultSanitizeReplacement
+	}
+	if s.maxPath == 0 {
+		s.maxPath = defaultMaxPathLength
+	}
+	return s
+}
+
+// utf16Len retourne la longueur d'une chaîne en unités UTF-16
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// percentEncode encode un caractère en %XX, octet par octet
+func percentEncode(r rune) string {
+	var b strings.Builder
+	buf := make([]byte, utf8.UTFMax)
+	for _, c := range buf[:utf8.EncodeRune(buf, r)] {
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// substitute retourne la forme adaptée d'un caractère selon le mode
+func (s *pathSanitizer) substitute(r rune) string {
+	if s.mode == SanitizeEncode {
+		return percentEncode(r)
+	}
+	return s.replacement
+}
+
+// component adapte un nom de fichier ou de répertoire et retourne les problèmes relevés
+func (s *pathSanitizer) component(name string) (string, []string) {
+	var problems []string
+
+	// Caractères interdits et caractères de contrôle
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || strings.ContainsRune(windowsInvalidChars, r) {
+			problems = append(problems, fmt.Sprintf("caractère interdit %q", r))
+			b.WriteString(s.substitute(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	result := b.String()
+
+	// Points et espaces finaux, supprimés silencieusement par Windows
+	if trimmed := strings.TrimRight(result, ". "); len(trimmed) < len(result) {
+		problems = append(problems, "point ou espace final")
+		var tail strings.Builder
+		for _, r := range result[len(trimmed):] {
+			tail.WriteString(s.substitute(r))
+		}
+		result = trimmed + tail.String()
+	}
+
+	// Noms de périphériques réservés, y compris suivis d'une extension
+	base, ext, hasExt := strings.Cut(result, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		problems = append(problems, fmt.Sprintf("nom réservé %s", base))
+		if s.mode == SanitizeEncode {
+			base = percentEncode(rune(base[0])) + base[1:]
+		} else {
+			base += s.replacement
+		}
+		result = base
+		if hasExt {
+			result += "." + ext
+		}
+	}
+
+	// Nom trop long: tronquer en conservant l'extension et un suffixe distinctif
+	if utf16Len(result) > maxComponentLength {
+		problems = append(problems, fmt.Sprintf("nom de plus de %d caractères", maxComponentLength))
+		result = shortenName(result, name)
+	}
+	return result, problems
+}
+
+// shortenName tronque un nom trop long, en conservant une extension courte et un suffixe
+// dérivé du nom d'origine pour que deux noms tronqués restent distincts
+func shortenName(name, original string) string {
+	ext := filepath.Ext(name)
+	if utf16Len(ext) > 16 {
+		ext = ""
+	}
+	suffix := fmt.Sprintf("~%08x", crc32.ChecksumIEEE([]byte(original)))
+	runes := []rune(strings.TrimSuffix(name, ext))
+	for len(runes) > 0 && utf16Len(string(runes))+utf16Len(suffix+ext) > maxComponentLength {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + suffix + ext
+}
+
+// sanitize adapte un chemin relatif composant par composant
+func (s *pathSanitizer) sanitize(file string) (string, error) {
+	parts := strings.Split(filepath.Clean(file), string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		adapted, found := s.component(part)
+		if len(found) > 0 && s.mode == SanitizeReject {
+			return "", fmt.Errorf("%w: nom %q incompatible avec Windows (%s)", ErrCopyRefused, part, strings.Join(found, ", "))
+		}
+		parts[i] = adapted
+	}
+	sanitized := filepath.Join(parts...)
+	if length := utf16Len(sanitized); length > s.maxPath {
+		return "", fmt.Errorf("%w: chemin de %d caractères, limite de %d pour la destination: %s", ErrCopyRefused, length, s.maxPath, file)
+	}
+	return sanitized, nil
+}
+
+// apply retourne le chemin relatif à utiliser à la destination. Le changement de nom est
+// journalisé, et un chemin adapté déjà attribué à un autre fichier est refusé.
+func (s *pathSanitizer) apply(id int, file string, logger *log.Logger) (string, error) {
+	if s == nil {
+		return file, nil
+	}
+	sanitized, err := s.sanitize(file)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	owner, taken := s.claimed[sanitized]
+	if !taken {
+		s.claimed[sanitized] = file
+	}
+	s.mu.Unlock()
+	if taken && owner != file {
+		return "", fmt.Errorf("%w: %s et %s aboutissent au même nom à la destination %s", ErrCopyRefused, owner, file, sanitized)
+	}
+
+	if sanitized != filepath.Clean(file) {
+		logger.Printf("Worker %d: Nom adapté pour la destination: %s -> %s\n", id, file, sanitized)
+	}
+	return sanitized, nil
+}
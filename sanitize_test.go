@@ -0,0 +1,104 @@
+// sanitize_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathSanitizer_Replace(t *testing.T) {
+	s := newPathSanitizer(&Config{SanitizeMode: SanitizeReplace})
+	cases := map[string]string{
+		"Artiste: Live?/piste *1*.flac": "Artiste_ Live_/piste _1_.flac",
+		"album./notes .txt ":            "album_/notes .txt_",
+		"CON.txt":                       "CON_.txt",
+		"disque/aux":                    "disque/aux_",
+		"Console.txt":                   "Console.txt",
+		"pochette.jpg":                  "pochette.jpg",
+	}
+	for file, want := range cases {
+		got, err := s.sanitize(filepath.FromSlash(file))
+		if err != nil {
+			t.Fatalf("Erreur inattendue pour %q: %v", file, err)
+		}
+		if got != filepath.FromSlash(want) {
+			t.Errorf("sanitize(%q) = %q, attendu %q", file, got, want)
+		}
+	}
+}
+
+func TestPathSanitizer_Encode(t *testing.T) {
+	s := newPathSanitizer(&Config{SanitizeMode: SanitizeEncode})
+	cases := map[string]string{
+		"a:b.flac":  "a%3Ab.flac",
+		"fin.":      "fin%2E",
+		"NUL":       "%4EUL",
+		"ok é.flac": "ok é.flac",
+	}
+	for file, want := range cases {
+		if got, err := s.sanitize(file); err != nil || got != want {
+			t.Errorf("sanitize(%q) = %q, %v; attendu %q", file, got, err, want)
+		}
+	}
+}
+
+func TestPathSanitizer_RejectAndLength(t *testing.T) {
+	s := newPathSanitizer(&Config{SanitizeMode: SanitizeReject})
+	if _, err := s.sanitize("piste|1.flac"); !errors.Is(err, ErrCopyRefused) {
+		t.Errorf("Erreur ErrCopyRefused attendue pour un nom interdit, obtenue: %v", err)
+	}
+	if got, err := s.sanitize("piste 1.flac"); err != nil || got != "piste 1.flac" {
+		t.Errorf("Un nom valide ne doit pas être modifié: %q, %v", got, err)
+	}
+
+	// Un nom trop long est tronqué en conservant son extension
+	s = newPathSanitizer(&Config{SanitizeMode: SanitizeReplace, SanitizeMaxPath: 1000})
+	long := strings.Repeat("é", 300) + ".flac"
+	got, err := s.sanitize(long)
+	if err != nil {
+		t.Fatalf("Erreur inattendue pour un nom long: %v", err)
+	}
+	if utf16Len(got) > maxComponentLength || !strings.HasSuffix(got, ".flac") {
+		t.Errorf("Nom long mal tronqué: %q", got)
+	}
+
+	// Un chemin trop long est refusé
+	s = newPathSanitizer(&Config{SanitizeMode: SanitizeReplace})
+	if _, err := s.sanitize(strings.Repeat("dossier/", 40) + "piste.flac"); !errors.Is(err, ErrCopyRefused) {
+		t.Errorf("Erreur ErrCopyRefused attendue pour un chemin trop long, obtenue: %v", err)
+	}
+}
+
+func TestCopyFiles_SanitizeCollision(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sanitize")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	os.MkdirAll(sourceDir, 0755)
+	files := []string{"a:b.flac", "a?b.flac", "ok.flac"}
+	for _, file := range files {
+		os.WriteFile(filepath.Join(sourceDir, file), []byte(file), 0644)
+	}
+
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 1, SanitizeMode: SanitizeReplace}
+	err = CopyFiles(context.Background(), config, files, InitTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "même nom") {
+		t.Errorf("Une erreur de collision était attendue, obtenue: %v", err)
+	}
+
+	// Le premier fichier garde le nom adapté, le second n'est pas copié par-dessus
+	content, err := os.ReadFile(filepath.Join(config.DestDir, "a_b.flac"))
+	if err != nil || string(content) != "a:b.flac" {
+		t.Errorf("Contenu de a_b.flac incorrect: %q, %v", string(content), err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "ok.flac")); err != nil {
+		t.Errorf("Les fichiers sans collision doivent être copiés: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// timestamps.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dates écrites sur le fichier de test: secondes impaires et fractions de seconde pour
+// révéler l'arrondi des systèmes de fichiers à granularité grossière (FAT, exFAT, SMB)
+var probeTimes = []time.Time{
+	time.Date(2020, 1, 15, 10, 0, 1, 123456789, time.UTC),
+	time.Date(2020, 1, 15, 10, 0, 2, 999999999, time.UTC),
+	time.Date(2020, 7, 15, 10, 0, 3, 500000000, time.UTC),
+}
+
+// probeTimestampResolution écrit un fichier de test dans le répertoire de destination et
+// mesure l'écart entre les dates demandées et celles relues. Retourne la résolution
+// effective arrondie à la seconde supérieure et un éventuel décalage d'heures entières.
+func probeTimestampResolution(destDir string) (time.Duration, time.Duration, error) {
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return 0, 0, fmt.Errorf("impossible de créer le répertoire de destination: %w", err)
+	}
+	probe := filepath.Join(destDir, tempFilePrefix+"probe"+tempFileSuffix)
+	if err := os.WriteFile(probe, nil, 0600); err != nil {
+		return 0, 0, fmt.Errorf("impossible d'écrire le fichier de test: %w", err)
+	}
+	defer os.Remove(probe)
+
+	var resolution, hourOffset time.Duration
+	for _, want := range probeTimes {
+		if err := os.Chtimes(probe, want, want); err != nil {
+			return 0, 0, fmt.Errorf("impossible de définir les dates du fichier de test: %w", err)
+		}
+		info, err := os.Stat(probe)
+		if err != nil {
+			return 0, 0, err
+		}
+		diff := info.ModTime().Sub(want)
+
+		// Séparer un décalage d'heures entières (fuseau horaire, heure d'été) de l'arrondi
+		hours := diff.Round(time.Hour)
+		if hours != 0 {
+			hourOffset = hours
+			diff -= hours
+		}
+		if abs(diff) > resolution {
+			resolution = abs(diff)
+		}
+	}
+
+	// Arrondir à la seconde supérieure, les comparaisons se faisant à la seconde près
+	if resolution > 0 {
+		resolution = (resolution + time.Second - 1).Truncate(time.Second)
+	}
+	return resolution, hourOffset, nil
+}
+
+// applyTimestampProbe mesure la résolution des dates de la destination et élargit la
+// tolérance de comparaison en conséquence
+func applyTimestampProbe(config *Config, logger *log.Logger) {
+	resolution, hourOffset, err := probeTimestampResolution(config.DestDir)
+	if err != nil {
+		logger.Printf("Impossible de mesurer la résolution des dates de la destination: %v\n", err)
+		return
+	}
+	if resolution > config.MtimeTolerance {
+		config.MtimeTolerance = resolution
+	}
+	logger.Printf("Résolution des dates de la destination: %v, tolérance appliquée: %v\n", resolution, config.MtimeTolerance)
+	if hourOffset != 0 && !config.IgnoreDSTOffset {
+		logger.Printf("Décalage de %v détecté sur les dates de la destination, l'option --ignore-dst permet de l'ignorer\n", hourOffset)
+	}
+}
@@ -0,0 +1,32 @@
+// timestamps_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProbeTimestampResolution(t *testing.T) {
+	dir, err := os.MkdirTemp("", "probe")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	resolution, hourOffset, err := probeTimestampResolution(filepath.Join(dir, "dest"))
+	if err != nil {
+		t.Fatalf("Erreur inattendue lors de la mesure: %v", err)
+	}
+	// Le répertoire temporaire local conserve les dates à la seconde près au minimum
+	if resolution > time.Second || hourOffset != 0 {
+		t.Errorf("Résolution inattendue %v (décalage %v)", resolution, hourOffset)
+	}
+
+	// Le fichier de test ne doit pas rester dans la destination
+	entries, _ := os.ReadDir(filepath.Join(dir, "dest"))
+	if len(entries) != 0 {
+		t.Errorf("Le répertoire de destination devrait être vide, contient %d entrées", len(entries))
+	}
+}
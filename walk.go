@@ -0,0 +1,254 @@
+// walk.go
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Les entrées de la liste qui désignent un répertoire sont remplacées par ses fichiers,
+// envoyés aux workers au fil du parcours plutôt qu'après un parcours complet.
+
+// fileSender envoie les fichiers de la liste aux workers
+type fileSender struct {
+	fileCh chan<- string
+	doneCh <-chan struct{}
+	config *Config
+	logger *log.Logger
+	filter *walkFilter
+	// Fichiers écartés par le filtre de parcours
+	filtered atomic.Int64
+	// Écart entre le nombre de fichiers envoyés et la taille de la liste, pour la progression
+	extra atomic.Int64
+}
+
+// send transmet un fichier à un worker, et retourne false en cas d'interruption
+func (s *fileSender) send(file string) bool {
+	select {
+	case <-s.doneCh:
+		return false
+	case s.fileCh <- file:
+		return true
+	}
+}
+
+// run envoie chaque entrée de la liste, en développant les répertoires. Les erreurs de
+// parcours sont journalisées et la dernière est retournée.
+func (s *fileSender) run(files []string) error {
+	var walkErr error
+	for _, file := range files {
+		select {
+		case <-s.doneCh:
+			return walkErr
+		default:
+		}
+		isDir, err := s.expand(file)
+		if err != nil {
+			s.logger.Printf("Erreur lors du parcours du répertoire %s: %v\n", file, err)
+			walkErr = fmt.Errorf("erreur lors du parcours du répertoire %s: %w", file, err)
+		}
+		if isDir {
+			// Le répertoire lui-même ne compte pas parmi les fichiers copiés
+			s.extra.Add(-1)
+			continue
+		}
+		if !s.send(file) {
+			return walkErr
+		}
+	}
+	return walkErr
+}
+
+// expand développe une entrée si elle désigne un répertoire de la source
+func (s *fileSender) expand(file string) (bool, error) {
+	if s.config.sourceArchive != nil {
+		files, emptyDirs, ok := s.config.sourceArchive.directory(file)
+		if !ok {
+			return false, nil
+		}
+		for _, dir := range emptyDirs {
+			s.emptyDir(dir, 0755)
+		}
+		for _, name := range files {
+			if s.filter != nil && s.archiveFiltered(name) {
+				s.filtered.Add(1)
+				continue
+			}
+			s.extra.Add(1)
+			if !s.send(name) {
+				break
+			}
+		}
+		return true, nil
+	}
+
+	// Un lien vers un répertoire n'est parcouru que si les liens sont suivis
+	follow := s.config.SymlinkMode == SymlinkFollow || s.config.SymlinkMode == ""
+	root := filepath.Join(s.config.SourceDir, file)
+	stat := os.Lstat
+	if follow {
+		stat = os.Stat
+	}
+	info, err := stat(root)
+	if err != nil || !info.IsDir() {
+		// Fichier ordinaire ou source manquante, signalée par le worker
+		return false, nil
+	}
+	if follow {
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return true, err
+		}
+	}
+	_, err = s.walk(file, root, follow, nil)
+	return true, err
+}
+
+// walk envoie les fichiers d'un répertoire réel de la source sous le nom file. En suivant
+// les liens, un lien vers un répertoire est parcouru à son tour, sauf s'il désigne un
+// répertoire en cours de parcours (boucle). ancestors contient les répertoires réels des
+// liens parcourus pour arriver à root. Retourne false en cas d'interruption.
+func (s *fileSender) walk(file, root string, follow bool, ancestors []string) (bool, error) {
+	stopped := false
+	var walkErr error
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Un sous-répertoire illisible n'interrompt pas le parcours
+			s.logger.Printf("Erreur lors du parcours de %s: %v\n", path, err)
+			walkErr = err
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(file, rel)
+		if follow && entry.Type()&fs.ModeSymlink != 0 {
+			if target, err := filepath.EvalSymlinks(path); err == nil {
+				if info, err := os.Stat(target); err == nil && info.IsDir() {
+					if s.filter.skipDir(name) {
+						return nil
+					}
+					chain := append(ancestors[:len(ancestors):len(ancestors)], filepath.Dir(path))
+					if linksToAncestor(target, chain) {
+						s.logger.Printf("Lien symbolique %s ignoré: boucle vers %s\n", name, target)
+						return nil
+					}
+					ok, err := s.walk(name, target, follow, chain)
+					if err != nil {
+						s.logger.Printf("Erreur lors du parcours de %s: %v\n", path, err)
+						walkErr = err
+					}
+					if !ok {
+						stopped = true
+						return filepath.SkipAll
+					}
+					return nil
+				}
+			}
+		}
+		if entry.IsDir() {
+			if path != root && s.filter.skipDir(name) {
+				return filepath.SkipDir
+			}
+			if s.config.EmptyDirs && isEmptyDir(path) {
+				if info, err := entry.Info(); err == nil {
+					s.emptyDir(name, info.Mode().Perm())
+				}
+			}
+			return nil
+		}
+		if s.filter != nil {
+			info, err := entry.Info()
+			if err == nil && follow && info.Mode()&fs.ModeSymlink != 0 {
+				info, err = os.Stat(path)
+			}
+			if err != nil || s.filter.skipFile(name, info) {
+				s.filtered.Add(1)
+				return nil
+			}
+		}
+		s.extra.Add(1)
+		if !s.send(name) {
+			stopped = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if stopped {
+		return false, nil
+	}
+	if err == nil {
+		err = walkErr
+	}
+	return true, err
+}
+
+// linksToAncestor indique si la cible d'un lien contient l'un des répertoires parcourus
+func linksToAncestor(target string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == target || strings.HasPrefix(dir, target+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveFiltered indique si une entrée de l'archive source est écartée par le filtre,
+// elle-même ou l'un de ses répertoires
+func (s *fileSender) archiveFiltered(name string) bool {
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		if s.filter.skipDir(dir) {
+			return true
+		}
+	}
+	entry, err := s.config.sourceArchive.lookup(name, false)
+	return err != nil || s.filter.skipFile(name, entry.info)
+}
+
+// isEmptyDir indique si un répertoire ne contient aucune entrée
+func isEmptyDir(path string) bool {
+	dir, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+	_, err = dir.Readdirnames(1)
+	return err == io.EOF
+}
+
+// emptyDir recrée un répertoire vide de la source à la destination, sous son nom adapté
+func (s *fileSender) emptyDir(dir string, perm fs.FileMode) {
+	config := s.config
+	if !config.EmptyDirs || archiveFormat(config.DestDir) != "" || config.CASMode == CASIndex {
+		return
+	}
+	destDir := filepath.Clean(dir)
+	if config.sanitizer != nil {
+		sanitized, err := config.sanitizer.sanitize(destDir)
+		if err != nil {
+			s.logger.Printf("Répertoire vide %s non recréé: %v\n", dir, err)
+			return
+		}
+		destDir = sanitized
+	}
+	if config.CollisionMode == CollisionNFC {
+		destDir = norm.NFC.String(destDir)
+	}
+	if err := os.MkdirAll(filepath.Join(config.DestDir, destDir), perm|0700); err != nil {
+		s.logger.Printf("Répertoire vide %s non recréé: %v\n", dir, err)
+		return
+	}
+	config.dirTimes.addDir(dir, destDir)
+	s.logger.Printf("Répertoire vide recréé: %s\n", destDir)
+}
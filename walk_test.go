@@ -0,0 +1,116 @@
+// walk_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFiles_DirectoryEntries(t *testing.T) {
+	dir, err := os.MkdirTemp("", "walk")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	for _, file := range []string{"album/cd1/01.flac", "album/cd2/01.flac", "album/cover.jpg", "autre.txt", "ignoré/x.txt"} {
+		path := filepath.Join(sourceDir, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(file), 0644)
+	}
+	os.MkdirAll(filepath.Join(sourceDir, "album", "scans"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "vide"), 0755)
+
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, EmptyDirs: true}
+	files := []string{"album", "autre.txt", "vide"}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+
+	for _, file := range []string{"album/cd1/01.flac", "album/cd2/01.flac", "album/cover.jpg", "autre.txt"} {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, filepath.FromSlash(file)))
+		if err != nil || string(content) != file {
+			t.Errorf("Fichier %s mal copié: %q, %v", file, string(content), err)
+		}
+	}
+	for _, empty := range []string{"album/scans", "vide"} {
+		if info, err := os.Stat(filepath.Join(config.DestDir, filepath.FromSlash(empty))); err != nil || !info.IsDir() {
+			t.Errorf("Le répertoire vide %s doit être recréé: %v", empty, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "ignoré")); !os.IsNotExist(err) {
+		t.Errorf("Un répertoire absent de la liste ne doit pas être copié")
+	}
+
+	// Sans l'option, les répertoires vides ne sont pas recréés
+	os.RemoveAll(config.DestDir)
+	config = &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2}
+	if err := CopyFiles(context.Background(), config, files, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DestDir, "vide")); !os.IsNotExist(err) {
+		t.Errorf("Le répertoire vide ne doit pas être recréé sans EmptyDirs")
+	}
+}
+
+func TestCopyFiles_DirectoryEntryInArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "walk")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	archivePath := filepath.Join(dir, "livraison.tar.gz")
+	writeTestTar(t, archivePath, true)
+	config := &Config{SourceDir: archivePath, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2}
+	if err := CopyFiles(context.Background(), config, []string{"disque 1"}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	checkExtracted(t, config.DestDir, map[string]string{
+		"disque 1/b.flac":    extractTestFiles["disque 1/b.flac"],
+		"disque 1/notes.txt": extractTestFiles["disque 1/notes.txt"],
+	})
+	if _, err := os.Stat(filepath.Join(config.DestDir, "a.flac")); !os.IsNotExist(err) {
+		t.Errorf("Seuls les fichiers du répertoire listé doivent être extraits")
+	}
+}
+
+func TestCopyFiles_DirectorySymlinks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "walk")
+	if err != nil {
+		t.Fatalf("Erreur lors de la création du répertoire temporaire: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "source")
+	path := filepath.Join(sourceDir, "album", "cd1", "01.flac")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("piste"), 0644)
+	// Un lien vers un répertoire frère et une boucle vers un répertoire parent
+	if err := os.Symlink("cd1", filepath.Join(sourceDir, "album", "lien")); err != nil {
+		t.Skipf("Liens symboliques non supportés: %v", err)
+	}
+	os.Symlink("..", filepath.Join(sourceDir, "album", "cd1", "boucle"))
+
+	config := &Config{SourceDir: sourceDir, DestDir: filepath.Join(dir, "dest"), ThreadCount: 2, SymlinkMode: SymlinkFollow}
+	start := time.Now()
+	if err := CopyFiles(context.Background(), config, []string{"album"}, InitTestLogger()); err != nil {
+		t.Fatalf("Erreur inattendue: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Copie trop lente, des liens ont-ils été réessayés comme fichiers ? %v", elapsed)
+	}
+	for _, file := range []string{"album/cd1/01.flac", "album/lien/01.flac"} {
+		content, err := os.ReadFile(filepath.Join(config.DestDir, filepath.FromSlash(file)))
+		if err != nil || string(content) != "piste" {
+			t.Errorf("Fichier %s mal copié: %q, %v", file, string(content), err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(config.DestDir, "album", "cd1", "boucle")); !os.IsNotExist(err) {
+		t.Errorf("La boucle ne doit pas être copiée")
+	}
+}
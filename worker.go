@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -20,22 +21,132 @@ func CopyFiles(ctx context.Context, config *Config, files []string, logger *log.
 	doneCh := ctx.Done()
 	var wg sync.WaitGroup
 
+	// Une destination d'archive est réécrite entièrement à chaque exécution
+	archivePath := ""
+	if archiveFormat(config.DestDir) != "" {
+		archivePath = config.DestDir
+	}
+
+	// Nettoyer les fichiers temporaires d'une exécution précédente interrompue
+	if archivePath == "" {
+		if err := cleanupTempFiles(config.DestDir, files, logger); err != nil {
+			logger.Printf("Erreur lors du nettoyage des fichiers temporaires: %v\n", err)
+		}
+	}
+
+	// Adapter la tolérance sur les dates à la résolution de la destination
+	if config.ProbeTimestamps && archivePath == "" {
+		applyTimestampProbe(config, logger)
+	}
+
+	// Refuser de supprimer des sources dont la copie n'est pas vérifiée
+	if err := validateMove(config); err != nil {
+		return err
+	}
+	config.movedDirs = newDirSet()
+	config.pendingSources = newPendingSources()
+
+	// Suivre les répertoires écrits pour restaurer leurs dates en fin de copie
+	if config.Preserve.DirTimes && archivePath == "" && archiveFormat(config.SourceDir) == "" && config.CASMode != CASIndex {
+		config.dirTimes = newDirSet()
+	}
+
+	// Détecter les liens physiques entre fichiers source et compter les méthodes de copie
+	config.links = newLinkTracker()
+	config.stats = newCopyStats()
+
+	// Limiteur de débit partagé, modifiable pendant la copie via BANDWIDTH_LIMIT_FILE
+	config.limiter = newRateLimiter(config.BandwidthLimit)
+	if config.BandwidthLimit > 0 {
+		logger.Printf("Limite de bande passante: %s\n", describeLimit(config.BandwidthLimit))
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if config.BandwidthLimitFile != "" {
+		go watchBandwidthFile(config.BandwidthLimitFile, config.limiter, stopCh, logger)
+	}
+
+	// Le chiffrement ne s'applique qu'aux copies de répertoire à répertoire
+	if config.EncryptionKey != nil && (archivePath != "" || archiveFormat(config.SourceDir) != "") {
+		return fmt.Errorf("le chiffrement n'est pas disponible avec une archive source ou destination")
+	}
+
+	// Stockage par contenu dans le répertoire de destination
+	if config.CASMode != "" {
+		if archivePath != "" || archiveFormat(config.SourceDir) != "" {
+			return fmt.Errorf("le stockage par contenu n'est pas disponible avec une archive source ou destination")
+		}
+		// Les contenus sont stockés sous l'empreinte du clair: un chiffré ne pourrait pas
+		// être vérifié ni partagé entre les chemins
+		if config.EncryptionKey != nil {
+			return fmt.Errorf("le stockage par contenu n'est pas disponible avec le chiffrement")
+		}
+		store, err := openCASStore(config.DestDir, config.CASMode)
+		if err != nil {
+			return err
+		}
+		config.cas = store
+		logger.Printf("Stockage par contenu (%s) dans %s\n", config.CASMode, filepath.Join(config.DestDir, casDir))
+	}
+
+	// Archive source lue directement, sans extraction préalable
+	if archiveFormat(config.SourceDir) != "" {
+		if archivePath != "" {
+			return fmt.Errorf("une archive source ne peut pas être copiée vers une archive")
+		}
+		source, err := openSourceArchive(config.SourceDir)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		config.sourceArchive = source
+		files = source.sortFiles(files)
+		logger.Printf("Lecture de l'archive source %s (%s, %d entrées)\n", config.SourceDir, source.format, len(source.entries))
+	}
+
+	// Adaptation des noms pour les destinations Windows/SMB
+	config.sanitizer = newPathSanitizer(config)
+
+	// Contrôle des noms qui se confondraient à la destination, avant toute copie
+	claims, err := preflightCollisions(files, config, logger)
+	if err != nil {
+		return err
+	}
+	config.claims = claims
+
+	// Filtres des fichiers trouvés en parcourant les répertoires
+	filter, err := newWalkFilter(config)
+	if err != nil {
+		return err
+	}
+
+	// Rédacteur unique de l'archive, alimenté par les workers
+	if archivePath != "" {
+		archive, err := openArchive(archivePath, config)
+		if err != nil {
+			return err
+		}
+		config.archive = archive
+		logger.Printf("Écriture dans l'archive %s (%s)\n", archivePath, archive.format)
+	}
+
+	// Canal des blocs de fichiers volumineux, pris en charge par les workers inoccupés
+	config.chunkCh = make(chan chunkJob)
+
 	// Lancer les workers
 	for i := 0; i < config.ThreadCount; i++ {
 		wg.Add(1)
-		go worker(i, &wg, config.SourceDir, config.DestDir, fileCh, progressCh, errorCh, doneCh, logger, config.VerifyHash)
+		go worker(i, &wg, config.SourceDir, config.DestDir, fileCh, progressCh, errorCh, doneCh, logger, config)
 	}
 
-	// Envoi des fichiers à copier
+	// Envoi des fichiers à copier, les répertoires étant développés au fil du parcours
+	sender := &fileSender{fileCh: fileCh, doneCh: doneCh, config: config, logger: logger, filter: filter}
+	var walkErr error
+	sentCh := make(chan struct{})
 	go func() {
+		defer close(sentCh)
 		defer close(fileCh)
-		for _, file := range files {
-			select {
-			case <-doneCh:
-				return
-			case fileCh <- file:
-			}
-		}
+		walkErr = sender.run(files)
 	}()
 
 	// Suivi de la progression
@@ -43,7 +154,7 @@ func CopyFiles(ctx context.Context, config *Config, files []string, logger *log.
 	progressWg.Add(1)
 	go func() {
 		defer progressWg.Done()
-		trackProgress(len(files), progressCh)
+		trackProgress(len(files), &sender.extra, progressCh, config.limiter)
 	}()
 
 	// Gestion des erreurs
@@ -74,6 +185,51 @@ func CopyFiles(ctx context.Context, config *Config, files []string, logger *log.
 	// Attendre que les goroutines de progression et d'erreur se terminent
 	progressWg.Wait()
 	errorWg.Wait()
+	<-sentCh
+	if walkErr != nil {
+		copyErr = walkErr
+	}
+	if filtered := sender.filtered.Load(); filtered > 0 {
+		logger.Printf("%d fichiers écartés par les filtres de parcours\n", filtered)
+	}
+
+	// Terminer l'archive, sauf interruption: une archive partielle n'est jamais publiée
+	// Les sources déplacées ne sont supprimées qu'une fois l'archive publiée
+	if config.archive != nil {
+		if err := config.archive.Close(ctx.Err() != nil); err != nil {
+			logger.Println(err)
+			copyErr = err
+			config.pendingSources.keep("archive non terminée", logger)
+		} else if ctx.Err() != nil {
+			config.pendingSources.keep("copie interrompue, archive non publiée", logger)
+		} else if err := config.pendingSources.remove(config, logger); err != nil {
+			logger.Println(err)
+			copyErr = err
+		}
+	}
+
+	// Enregistrer l'index du stockage par contenu
+	if config.cas != nil {
+		if err := config.cas.saveIndex(); err != nil {
+			logger.Println(err)
+			copyErr = err
+			config.pendingSources.keep("index du stockage par contenu non enregistré", logger)
+		} else if err := config.pendingSources.remove(config, logger); err != nil {
+			logger.Println(err)
+			copyErr = err
+		}
+	}
+
+	// Restaurer les dates des répertoires une fois tous les fichiers écrits
+	restoreDirTimes(config.dirTimes, config.SourceDir, config.DestDir, config.Preserve, logger)
+
+	// Supprimer les répertoires source vidés par le déplacement
+	if config.Move {
+		pruneEmptyDirs(config.movedDirs, config.SourceDir, logger)
+	}
+
+	// Résumé des méthodes de copie utilisées
+	config.stats.report(logger)
 
 	if copyErr != nil {
 		return copyErr
@@ -81,31 +237,81 @@ func CopyFiles(ctx context.Context, config *Config, files []string, logger *log.
 	return nil
 }
 
-func worker(id int, wg *sync.WaitGroup, sourceDir, destDir string, fileCh <-chan string, progressCh chan<- int, errorCh chan<- error, doneCh <-chan struct{}, logger *log.Logger, verifyHash bool) {
+// transferFile copie un fichier vers la destination configurée: archive, stockage par
+// contenu ou arborescence, depuis un répertoire ou une archive source
+func transferFile(id int, file, sourcePath, destFile, destPath string, config *Config, logger *log.Logger) error {
+	switch {
+	case config.archive != nil:
+		return archiveFile(sourcePath, id, destFile, config, logger)
+	case config.cas != nil:
+		return casFile(sourcePath, id, destFile, destPath, config, logger)
+	case config.sourceArchive != nil:
+		return extractFile(file, id, destPath, config, logger)
+	}
+	return copyFile(sourcePath, id, destPath, config, logger)
+}
+
+func worker(id int, wg *sync.WaitGroup, sourceDir, destDir string, fileCh <-chan string, progressCh chan<- int, errorCh chan<- error, doneCh <-chan struct{}, logger *log.Logger, config *Config) {
 	defer wg.Done()
 	for {
 		select {
 		case <-doneCh:
 			logger.Printf("Worker %d: Arrêté suite à une interruption\n", id)
 			return
+		case job := <-config.chunkCh:
+			job.run(id, logger)
 		case file, ok := <-fileCh:
 			if !ok {
 				return
 			}
 
 			sourcePath := filepath.Join(sourceDir, file)
-			destPath := filepath.Join(destDir, file)
+
+			// Adapter le nom à la destination si nécessaire
+			destFile, err := destinationName(id, file, config, logger)
+			if err != nil {
+				errorCh <- fmt.Errorf("worker %d: %v", id, err)
+				continue
+			}
+			destPath := filepath.Join(destDir, destFile)
+
+			// Taille et empreinte annoncées par la liste CSV, vérifiées une fois avant la copie
+			// (l'empreinte l'est pendant la copie lorsque c'est possible)
+			if err := checkListedFile(id, file, sourcePath, config, logger); err != nil {
+				if os.IsNotExist(err) {
+					errorCh <- fmt.Errorf("worker %d: Fichier source manquant %s", id, sourcePath)
+				} else {
+					errorCh <- fmt.Errorf("worker %d: %v", id, err)
+				}
+				continue
+			}
 
 			retries := 0
 			for {
-				err := copyFile(sourcePath, id, destPath, verifyHash, logger)
-				if err == nil {
+				err := transferFile(id, file, sourcePath, destFile, destPath, config, logger)
+				if err == nil || errors.Is(err, ErrCopyIgnored) {
+					// Empreinte de la liste non contrôlée pendant la copie
+					if err := checkListedCopy(id, file, sourcePath, config, logger); err != nil {
+						errorCh <- fmt.Errorf("worker %d: %v", id, err)
+						break
+					}
+					// Copie effectuée ou ignorée sans retry
+					copied := err == nil
+					if copied {
+						config.dirTimes.addMapped(file, destFile)
+					}
+					// En mode déplacement, supprimer la source une fois la destination validée
+					if config.Move {
+						if err := removeMovedSource(id, file, sourcePath, destPath, copied, config, logger); err != nil {
+							errorCh <- fmt.Errorf("worker %d: %v", id, err)
+						}
+					}
 					progressCh <- 1
 					break
 				}
-				// Gestion du cas de copie ignorée sans retry
-				if err == ErrCopyIgnored {
-					progressCh <- 1
+				// Gestion des copies refusées sans retry
+				if errors.Is(err, ErrCopyRefused) {
+					errorCh <- fmt.Errorf("worker %d: %v", id, err)
 					break
 				}
 				// Gestion de la source manquante sans retry
@@ -123,7 +329,7 @@ func worker(id int, wg *sync.WaitGroup, sourceDir, destDir string, fileCh <-chan
 				}
 
 				// Nouvelle tentative après attente
-				logger.Printf("Worker %d: Erreur lors de la copie de %s, nouvelle tentative (%d/%d)\n", id, sourcePath, retries, maxRetries)
+				logger.Printf("Worker %d: Erreur lors de la copie de %s, nouvelle tentative (%d/%d): %v\n", id, sourcePath, retries, maxRetries, err)
 				time.Sleep(2 * time.Second)
 			}
 		}
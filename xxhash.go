@@ -0,0 +1,131 @@
+// xxhash.go
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Implémentation de xxHash64 (https://github.com/Cyan4973/xxHash), hash rapide
+// non cryptographique utilisé pour comparer des fichiers volumineux
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxh64 struct {
+	seed           uint64
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [32]byte
+	n              int
+}
+
+// newXXH64 crée un hash xxHash64 avec une graine nulle
+func newXXH64() hash.Hash64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	d.v1 = d.seed + xxPrime1 + xxPrime2
+	d.v2 = d.seed + xxPrime2
+	d.v3 = d.seed
+	d.v4 = d.seed - xxPrime1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func (d *xxh64) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+
+	// Compléter le bloc en attente
+	if d.n+len(b) < 32 {
+		d.n += copy(d.mem[d.n:], b)
+		return n, nil
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.consume(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+
+	// Traiter les blocs complets de 32 octets
+	for len(b) >= 32 {
+		d.consume(b[:32])
+		b = b[32:]
+	}
+	d.n = copy(d.mem[:], b)
+	return n, nil
+}
+
+func (d *xxh64) consume(b []byte) {
+	d.v1 = xxRound(d.v1, binary.LittleEndian.Uint64(b[0:8]))
+	d.v2 = xxRound(d.v2, binary.LittleEndian.Uint64(b[8:16]))
+	d.v3 = xxRound(d.v3, binary.LittleEndian.Uint64(b[16:24]))
+	d.v4 = xxRound(d.v4, binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) +
+			bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = xxMergeRound(h, d.v1)
+		h = xxMergeRound(h, d.v2)
+		h = xxMergeRound(h, d.v3)
+		h = xxMergeRound(h, d.v4)
+	} else {
+		h = d.seed + xxPrime5
+	}
+	h += d.total
+
+	// Traiter les octets restants
+	p := d.mem[:d.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, c := range p {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	// Avalanche finale
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}